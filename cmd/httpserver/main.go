@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"io"
 	"log"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
-	"strings"
+	"time"
 	"crypto/sha256"
 	"github.com/TJ-R/httpfromtcp/internal/request"
 	"github.com/TJ-R/httpfromtcp/internal/response"
@@ -16,25 +19,56 @@ import (
 )
 
 const port = 42069
+const shutdownTimeout = 10 * time.Second
 
 func main() {
-	server, err := server.Serve(port, handlerFunc)
+	router := server.NewRouter()
+	router.Use(server.Logger(nil), server.Compress)
+	router.Get("/yourproblem", handleYourProblem)
+	router.Get("/myproblem", handleMyProblem)
+	router.Get("/httpbin/*", handleHttpbin)
+	router.Get("/video", handleVideo)
+	router.Get("/*", handleDefault)
+
+	srv := &server.Server{
+		Addr:          fmt.Sprintf(":%d", port),
+		Handler:       router.ServeRequest,
+		ReadTimeout:   10 * time.Second,
+		WriteTimeout:  time.Minute,
+		IdleTimeout:   time.Minute,
+		MaxConns:      1024,
+		MaxConnsPerIP: 64,
+	}
+
+	l, err := net.Listen("tcp", srv.Addr)
 	if err != nil {
 		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
 	log.Println("Server started on port", port)
 
+	go func() {
+		if err := srv.Serve(l); !errors.Is(err, server.ErrServerClosed) {
+			log.Fatalf("Error serving: %v", err)
+		}
+	}()
+
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	<-sigChan
+
+	// Give requests in flight a chance to finish
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Error shutting down: %v", err)
+		return
+	}
 	log.Println("Server gracefully stopped")
 }
 
-func handlerFunc(w *response.Writer, req *request.Request) {
-	if req.RequestLine.RequestTarget == "/yourproblem" {
-		w.WriteStatusLine(400)
-		body := 
+func handleYourProblem(w *response.Writer, req *request.Request) {
+	w.SetStatus(response.StatusClientError)
+	body := 
 `
 <html>
   <head>
@@ -47,13 +81,13 @@ func handlerFunc(w *response.Writer, req *request.Request) {
 </html>
 `
 
-		headers := response.GetDefaultHeaders(len(body))
-		headers["content-type"] = "text/html"
-		w.WriteHeaders(headers)
-		w.WriteBody([]byte(body))
-	} else if req.RequestLine.RequestTarget == "/myproblem" {
-		w.WriteStatusLine(500)
-		body := 
+	w.Header().Set("content-type", "text/html")
+	w.Write([]byte(body))
+}
+
+func handleMyProblem(w *response.Writer, req *request.Request) {
+	w.SetStatus(response.StatusServerError)
+	body := 
 `
 <html>
   <head>
@@ -66,83 +100,96 @@ func handlerFunc(w *response.Writer, req *request.Request) {
 </html>
 `
 
-		headers := response.GetDefaultHeaders(len(body))
-		headers["content-type"] = "text/html"
-		w.WriteHeaders(headers)
-		w.WriteBody([]byte(body))
-	} else if strings.HasPrefix(req.RequestLine.RequestTarget, "/httpbin") {
-
-		path := strings.TrimPrefix(req.RequestLine.RequestTarget, "/httpbin")
-		url := "https://httpbin.org/" + path
-		res, err := http.Get(url)	
-		if err != nil { 
-			log.Println(err)
-		} 
-
-		w.WriteStatusLine(response.StatusOk)
+	w.Header().Set("content-type", "text/html")
+	w.Write([]byte(body))
+}
 
-		headers := response.GetDefaultHeaders(0)
-		delete(headers, "content-length")
+func handleHttpbin(w *response.Writer, req *request.Request) {
+	url := "https://httpbin.org/" + req.Param("*")
+	res, err := http.Get(url)	
+	if err != nil { 
+		log.Println(err)
+		w.SetStatus(response.StatusBadGateway)
+		w.Write([]byte(response.StatusText(response.StatusBadGateway)))
+		return
+	} 
+	defer res.Body.Close()
+
+	w.WriteStatusLine(response.StatusOk)
+
+	headers := response.GetDefaultHeaders(0)
+	delete(headers, "content-length")
         headers["Transfer-Encoding"] = "chunked" 
-		headers["Trailers"] = "X-Content-SHA256, X-Content-Length"
-		w.WriteHeaders(headers)
-
-		buf := make([]byte, 1024)
-		totalBytesBody := 0
-		var respBody []byte
-
-		for { 
-			n, err := res.Body.Read(buf)
-			respBody = append(respBody, buf[:n]...)
-			totalBytesBody += n
-			
-			if n == 0 {
-				w.WriteChunkedBodyDone()
-				break
-			}
-
-			n, err = w.WriteChunkedBody(buf[:n])
-
-
-			if err == io.EOF {
-				break
-			}
-
-			if err != nil {
-				log.Printf("Error: when reading chunk %v\n", err)
-				break
-			}
+	headers["Trailer"] = "X-Content-SHA256, X-Content-Length"
+	w.WriteHeaders(headers)
+
+	buf := make([]byte, 1024)
+	totalBytesBody := 0
+	var respBody []byte
+
+	for { 
+		n, err := res.Body.Read(buf)
+		respBody = append(respBody, buf[:n]...)
+		totalBytesBody += n
+		
+		if n == 0 {
+			w.WriteChunkedBodyDone()
+			break
 		}
 
-		trailers := response.GetDefaultTrailers()
+		n, err = w.WriteChunkedBody(buf[:n])
 
-		hash := sha256.Sum256(respBody)
-		trailers["X-Content-SHA256"] = fmt.Sprintf("%x", hash)
-		trailers["X-Content-Length"] = fmt.Sprintf("%d", totalBytesBody)
 
-		err = w.WriteTrailers(trailers)
-		if err != nil {
-			log.Println(err)
+		if err == io.EOF {
+			break
 		}
-	} else if req.RequestLine.RequestTarget == "/video" {
-		if err := w.WriteStatusLine(200); err != nil {
-			// Should respond with an internal server error
-			log.Println(err)
-		}	
 
-		body, err := os.ReadFile("./assets/vim.mp4")
 		if err != nil {
-			log.Println(err)
+			log.Printf("Error: when reading chunk %v\n", err)
+			break
 		}
 
-		headers := response.GetDefaultHeaders(len(body))
-		headers["content-type"] = "video/mp4"
-		w.WriteHeaders(headers)
-		w.WriteBody([]byte(body))
+		// Push each chunk out as it arrives from httpbin
+		if err := w.Flush(); err != nil {
+			log.Printf("Error: when flushing chunk %v\n", err)
+			break
+		}
+	}
+
+	trailers := response.GetDefaultTrailers()
 
-	} else {
-		w.WriteStatusLine(200)
-		body := 
+	hash := sha256.Sum256(respBody)
+	trailers["X-Content-SHA256"] = fmt.Sprintf("%x", hash)
+	trailers["X-Content-Length"] = fmt.Sprintf("%d", totalBytesBody)
+
+	err = w.WriteTrailers(trailers)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+func handleVideo(w *response.Writer, req *request.Request) {
+	video, err := os.Open("./assets/vim.mp4")
+	if err != nil {
+		log.Println(err)
+		w.SetStatus(response.StatusServerError)
+		return
+	}
+	defer video.Close()
+
+	if info, err := video.Stat(); err == nil {
+		w.SetLastModified(info.ModTime())
+		w.SetETag(fmt.Sprintf("%x-%x", info.ModTime().Unix(), info.Size()), false)
+	}
+
+	w.Header().Set("content-type", "video/mp4")
+	if err := response.ServeContent(w, req, video); err != nil {
+		log.Println(err)
+	}
+}
+
+func handleDefault(w *response.Writer, req *request.Request) {
+	body := 
 `
 <html>
   <head>
@@ -155,9 +202,6 @@ func handlerFunc(w *response.Writer, req *request.Request) {
 </html>
 `
 
-		headers := response.GetDefaultHeaders(len(body))
-		headers["content-type"] = "text/html"
-		w.WriteHeaders(headers)
-		w.WriteBody([]byte(body))
-	}
+	w.Header().Set("content-type", "text/html")
+	w.Write([]byte(body))
 }
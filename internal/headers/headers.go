@@ -26,6 +26,9 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 
 	// Deal with stuff before \r\n
 	headerParts := bytes.SplitN(data[:index], []byte(":"), 2) 
+	if len(headerParts) != 2 {
+		return 0, false, fmt.Errorf("Missing colon in header")
+	}
 
 	fieldName := string(headerParts[0])
 
@@ -56,3 +59,39 @@ func (h Headers) Parse(data []byte) (n int, done bool, err error) {
 
 	return index + 2, false, nil
 }
+
+func (h Headers) Get(key string) string {
+	value, _ := h.Lookup(key)
+	return value
+}
+
+// Lookup is like Get but also reports whether the key was present, so an
+// explicitly empty value can be told apart from a missing one.
+func (h Headers) Lookup(key string) (string, bool) {
+	value, ok := h[strings.ToLower(key)]
+	if ok {
+		return value, true
+	}
+
+	// Handlers may have set a header directly with a non lowercase key
+	for k, v := range h {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+
+	return "", false
+}
+
+func (h Headers) Set(key, value string) {
+	h.Delete(key)
+	h[strings.ToLower(key)] = value
+}
+
+func (h Headers) Delete(key string) {
+	for k := range h {
+		if strings.EqualFold(k, key) {
+			delete(h, k)
+		}
+	}
+}
@@ -75,4 +75,40 @@ func TestHeadersParse(t *testing.T) {
 	require.Error(t, err)
 	assert.Equal(t, 0, n)
 	assert.False(t, done)
+
+	// Test: Missing colon
+	headers = NewHeaders()
+	data = []byte("Bogus\r\n\r\n")
+	n, done, err = headers.Parse(data)
+	require.Error(t, err)
+	assert.Equal(t, 0, n)
+	assert.False(t, done)
+}
+
+func TestHeadersAccessors(t *testing.T) {
+	// Test: Get is case insensitive
+	headers := NewHeaders()
+	headers["Transfer-Encoding"] = "chunked"
+	assert.Equal(t, "chunked", headers.Get("transfer-encoding"))
+	assert.Equal(t, "", headers.Get("content-length"))
+
+	// Test: Set replaces any casing of the key
+	headers.Set("TRANSFER-ENCODING", "identity")
+	assert.Equal(t, "identity", headers["transfer-encoding"])
+	assert.Len(t, headers, 1)
+
+	// Test: Lookup reports presence of empty values
+	headers["Server"] = ""
+	value, ok := headers.Lookup("server")
+	assert.True(t, ok)
+	assert.Equal(t, "", value)
+	_, ok = headers.Lookup("date")
+	assert.False(t, ok)
+	delete(headers, "Server")
+
+	// Test: Delete removes any casing of the key
+	headers["Content-Type"] = "text/plain"
+	headers.Delete("content-type")
+	assert.Equal(t, "", headers.Get("Content-Type"))
+	assert.Len(t, headers, 1)
 }
@@ -1,7 +1,10 @@
 package request
 
 import (
+	"context"
+	"crypto/tls"
 	"io"
+	"maps"
 	"strings"
 	"fmt"
 	"errors"
@@ -12,11 +15,34 @@ import (
 
 const bufferSize = 8
 
+var ErrHeaderTooLarge = errors.New("Request header too large")
+
+// ErrTransferEncoding is returned for requests with a Transfer-Encoding.
+// Their bodies are only framed by Content-Length, so reading on would
+// take the body for the next request.
+var ErrTransferEncoding = errors.New("Transfer-Encoding is not supported")
+
 type Request struct {
 	RequestLine RequestLine
 	parserState ParserState
 	Headers headers.Headers
 	Body []byte
+
+	// Bytes read from the connection past the end of this request
+	leftover []byte
+
+	// Params holds the path parameters captured by the route that matched
+	// the request
+	Params map[string]string
+
+	// TLS describes the connection the request arrived on, nil for plain
+	// connections
+	TLS *tls.ConnectionState
+
+	// Size of the request line and headers
+	headerBytes int
+
+	ctx context.Context
 }
 
 type RequestLine struct {
@@ -50,6 +76,13 @@ func (p ParserState) String() string {
 
 
 func RequestFromReader(reader io.Reader) (*Request, error) {
+	return RequestFromReaderWithLimit(reader, 0)
+}
+
+// RequestFromReaderWithLimit is RequestFromReader failing with
+// ErrHeaderTooLarge once the request line and headers pass maxHeaderBytes.
+// A limit of 0 or less means no limit.
+func RequestFromReaderWithLimit(reader io.Reader, maxHeaderBytes int) (*Request, error) {
 	buf := make([]byte, bufferSize, bufferSize)
 
 	readToIndex := 0
@@ -88,11 +121,32 @@ func RequestFromReader(reader io.Reader) (*Request, error) {
 
 
 		readToIndex -= bytesParsed
+
+		if maxHeaderBytes > 0 {
+			headerBytes := newRequest.headerBytes
+			if newRequest.parserState == Initialized || newRequest.parserState == RequestStateParsingHeaders {
+				headerBytes += readToIndex
+			}
+			if headerBytes > maxHeaderBytes {
+				return nil, ErrHeaderTooLarge
+			}
+		}
+	}
+
+	if readToIndex > 0 {
+		newRequest.leftover = append([]byte(nil), buf[:readToIndex]...)
 	}
 
 	return &newRequest, nil
 }
 
+// Leftover returns bytes that were read from the reader after the end of the
+// request, such as the start of a pipelined request or of a protocol the
+// connection is upgraded to.
+func (r *Request) Leftover() []byte {
+	return r.leftover
+}
+
 func parseRequestLine(data []byte) (*RequestLine, int, error) {
 	idx := bytes.Index(data, []byte("\r\n"))
 
@@ -112,6 +166,9 @@ func parseRequestLine(data []byte) (*RequestLine, int, error) {
 
 func requestLineFromString(line string) (*RequestLine, error) {
 	requestSplit := strings.Split(line, " ")
+	if len(requestSplit) != 3 {
+		return nil, fmt.Errorf("Invalid request line: %s", line)
+	}
 
 	method := requestSplit[0]
 	for _, c := range method {
@@ -121,8 +178,8 @@ func requestLineFromString(line string) (*RequestLine, error) {
 	}
 
 	httpVersion := strings.Split(requestSplit[2], "/")
-	if httpVersion[0] != "HTTP" {
-		return nil,  fmt.Errorf("Http Version is incorrect %s", httpVersion[0])
+	if httpVersion[0] != "HTTP" || len(httpVersion) != 2 {
+		return nil,  fmt.Errorf("Http Version is incorrect %s", requestSplit[2])
 	}
 	if httpVersion[1] != "1.1" {
 		return nil, fmt.Errorf("Http Version is incorrect %s", httpVersion[1])
@@ -138,6 +195,26 @@ func requestLineFromString(line string) (*RequestLine, error) {
 }
 
 func (r *Request) parse(data []byte) (int, error) {
+	totalBytesParsed := 0
+
+	// Keep going while there is data, the body may have arrived in the same
+	// read as the headers
+	for r.parserState != Done {
+		n, err := r.parseState(data[totalBytesParsed:])
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			break
+		}
+
+		totalBytesParsed += n
+	}
+
+	return totalBytesParsed, nil
+}
+
+func (r *Request) parseState(data []byte) (int, error) {
 	switch r.parserState {
 	case Initialized:
 		requestLine, bytesRead, err := parseRequestLine(data)
@@ -152,22 +229,24 @@ func (r *Request) parse(data []byte) (int, error) {
 		// Update Request  Line field and change state to headers
 		r.parserState = RequestStateParsingHeaders
 		r.RequestLine = *requestLine
+		r.headerBytes += bytesRead
 		return bytesRead, nil
 	
 	case RequestStateParsingHeaders:
 		totalBytesParsed := 0
 
-		for r.parserState != Done {
+		for r.parserState == RequestStateParsingHeaders {
 			n, err := r.parseSingle(data[totalBytesParsed:])	
 
 			if err != nil {
-				return 0, fmt.Errorf("Error: %v", err)
+				return 0, fmt.Errorf("Error: %w", err)
 			}
 			if n == 0 {
 				return totalBytesParsed, nil
 			}
 
 			totalBytesParsed += n
+			r.headerBytes += n
 		}
 
 		return totalBytesParsed, nil
@@ -184,22 +263,15 @@ func (r *Request) parse(data []byte) (int, error) {
 			return 0, nil
 		} 
 
-		r.Body = append(r.Body, data...)
-
-		if len(data) == 0 && len(r.Body) < contentLengthValue {
-			return 0, fmt.Errorf("Error: Body is less than content length")
-		}
-		
-		if len(r.Body) > contentLengthValue {
-			return 0, fmt.Errorf("Error: Body is greater than content length")
-		}
+		// Anything past content-length belongs to whatever follows the request
+		n := min(len(data), contentLengthValue-len(r.Body))
+		r.Body = append(r.Body, data[:n]...)
 
 		if len(r.Body) == contentLengthValue {
 			r.parserState = Done
-			return 0, nil
 		}
 
-		return len(data), nil
+		return n, nil
 
 	case Done:
 		return 0, fmt.Errorf("Attempting read data in done state")
@@ -217,10 +289,13 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	}
 
 	if done {
+		if _, ok := r.Headers.Lookup("Transfer-Encoding"); ok {
+			return 0, ErrTransferEncoding
+		}
 
 		if r.Get("Content-Length") == "" || r.Get("Content-Length") == "0" {
 			r.parserState = Done
-			return bytesParsed, nil
+			return bytesParsed+2, nil
 		} else {
 			r.parserState = RequestStateParsingBody
 			return bytesParsed+2, nil
@@ -234,6 +309,55 @@ func (r *Request) parseSingle(data []byte) (int, error) {
 	return bytesParsed, nil
 }
 
+// Context is the request's context, carrying values from the server's
+// BaseContext. It is canceled once the connection is done with.
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+
+	return context.Background()
+}
+
+// WithContext returns a shallow copy of r using ctx
+func (r *Request) WithContext(ctx context.Context) *Request {
+	if ctx == nil {
+		panic("nil context")
+	}
+
+	r2 := *r
+	r2.ctx = ctx
+	return &r2
+}
+
+// Clone returns a deep copy of r using ctx. Changes to the copy's headers,
+// body, params or TLS state do not reach r.
+func (r *Request) Clone(ctx context.Context) *Request {
+	r2 := r.WithContext(ctx)
+	r2.Headers = maps.Clone(r.Headers)
+	r2.Body = bytes.Clone(r.Body)
+	r2.leftover = bytes.Clone(r.leftover)
+	r2.Params = maps.Clone(r.Params)
+	if r.TLS != nil {
+		state := *r.TLS
+		r2.TLS = &state
+	}
+
+	return r2
+}
+
+// Path is the request target without its query string
+func (r *Request) Path() string {
+	path, _, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+	return path
+}
+
+// Param returns a path parameter captured by the router, or "" when the
+// route has no parameter of that name
+func (r *Request) Param(name string) string {
+	return r.Params[name]
+}
+
 func (r *Request) Get(key string) string {
 	value, ok := r.Headers[strings.ToLower(key)]
 	if !ok {
@@ -1,7 +1,10 @@
 package request
 
 import (
+	"context"
+	"crypto/tls"
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -68,6 +71,22 @@ func TestRequestLineParse(t *testing.T) {
 	}
 	r, err = RequestFromReader(reader)
 	require.Error(t, err)
+
+	// Test: Valid method with a missing version
+	reader = &chunkReader{
+		data:            "GET /coffee\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Version without a number
+	reader = &chunkReader{
+		data:            "GET /coffee HTTP\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = RequestFromReader(reader)
+	require.Error(t, err)
 }
 
 
@@ -203,6 +222,105 @@ func TestParsingBody(t *testing.T) {
 	assert.Equal(t, 0, len(r.Body))
 }
 
+func TestLeftover(t *testing.T) {
+	// Test: Body arriving in the same read as the headers
+	reader := &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"hello",
+		numBytesPerRead: 1024,
+	}
+	r, err := RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+	assert.Empty(t, r.Leftover())
+
+	// Test: Bytes read past the body are kept
+	reader = &chunkReader{
+		data: "POST /submit HTTP/1.1\r\n" +
+			"Content-Length: 5\r\n" +
+			"\r\n" +
+			"helloGET / HTTP/1.1\r\n",
+		numBytesPerRead: 1024,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(r.Body))
+	assert.Equal(t, "GET / HTTP/1.1\r\n", string(r.Leftover())+reader.data[reader.pos:])
+
+	// Test: Bytes read past the headers are kept
+	reader = &chunkReader{
+		data:            "GET /chat HTTP/1.1\r\nUpgrade: websocket\r\n\r\n\x81\x85",
+		numBytesPerRead: 1024,
+	}
+	r, err = RequestFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "\x81\x85", string(r.Leftover())+reader.data[reader.pos:])
+}
+
+func TestHeaderLimit(t *testing.T) {
+	data := "POST /submit HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 11\r\n\r\nhello world"
+	headerSize := len(data) - len("hello world")
+
+	// Test: Headers that fit, the body does not count
+	reader := &chunkReader{data: data, numBytesPerRead: 4}
+	r, err := RequestFromReaderWithLimit(reader, headerSize)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(r.Body))
+
+	// Test: One byte over
+	reader = &chunkReader{data: data, numBytesPerRead: 4}
+	_, err = RequestFromReaderWithLimit(reader, headerSize-1)
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+
+	// Test: Header that never ends is cut off
+	reader = &chunkReader{data: "GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("a", 10000), numBytesPerRead: 64}
+	_, err = RequestFromReaderWithLimit(reader, 1024)
+	require.ErrorIs(t, err, ErrHeaderTooLarge)
+	assert.Less(t, reader.pos, 2048)
+}
+
+func TestTransferEncoding(t *testing.T) {
+	// Test: Chunked bodies are refused rather than read as the next request
+	reader := &chunkReader{
+		data:            "POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err := RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrTransferEncoding)
+
+	// Test: Content-Length does not make up for it
+	reader = &chunkReader{
+		data:            "POST / HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = RequestFromReader(reader)
+	require.ErrorIs(t, err, ErrTransferEncoding)
+}
+
+type contextKey struct{}
+
+func TestClone(t *testing.T) {
+	r, err := RequestFromReader(strings.NewReader("POST /users/7 HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\nabc"))
+	require.NoError(t, err)
+	r.Params = map[string]string{"id": "7"}
+	r.TLS = &tls.ConnectionState{ServerName: "localhost"}
+
+	// Test: Changes to the clone stay there
+	ctx := context.WithValue(context.Background(), contextKey{}, "value")
+	clone := r.Clone(ctx)
+	clone.Params["id"] = "8"
+	clone.Headers.Set("Host", "other")
+	clone.Body[0] = 'x'
+	clone.TLS.ServerName = "other"
+	assert.Equal(t, "7", r.Param("id"))
+	assert.Equal(t, "localhost", r.Get("Host"))
+	assert.Equal(t, "abc", string(r.Body))
+	assert.Equal(t, "localhost", r.TLS.ServerName)
+	assert.Equal(t, "value", clone.Context().Value(contextKey{}))
+}
+
 type chunkReader struct {
 	data            string
 	numBytesPerRead int
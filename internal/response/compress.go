@@ -0,0 +1,176 @@
+package response
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strings"
+)
+
+const DefaultCompressionMinSize = 1024
+
+// Media types that are already compressed and gain nothing from another pass
+var incompressibleTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"application/zip",
+	"application/gzip",
+	"application/x-gzip",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/zstd",
+}
+
+type compressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// EnableCompression lets the writer compress the body with a content coding
+// negotiated from the request's Accept-Encoding value. The decision is made
+// when the headers are written.
+func (writer *Writer) EnableCompression(acceptEncoding string) {
+	writer.compressionEnabled = true
+	writer.acceptEncoding = acceptEncoding
+}
+
+// NegotiateEncoding picks gzip or deflate from an Accept-Encoding value,
+// preferring the higher q-value and gzip on a tie. An empty encoding means
+// the body should be sent as is. identityOk is false when the client ruled
+// out uncompressed responses with identity;q=0 or *;q=0.
+func NegotiateEncoding(acceptEncoding string) (encoding string, identityOk bool) {
+	qvalues := parseQValues(acceptEncoding)
+
+	qvalue := func(coding string) float64 {
+		if q, ok := qvalues[coding]; ok {
+			return q
+		}
+		if q, ok := qvalues["*"]; ok {
+			return q
+		}
+		if coding == "identity" {
+			return 1
+		}
+		return 0
+	}
+
+	identityOk = qvalue("identity") > 0
+	gzipQ, deflateQ := qvalue("gzip"), qvalue("deflate")
+	switch {
+	case gzipQ > 0 && gzipQ >= deflateQ:
+		return "gzip", identityOk
+	case deflateQ > 0:
+		return "deflate", identityOk
+	}
+
+	return "", identityOk
+}
+
+func compressible(contentType string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, prefix := range incompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// setupCompression decides from the headers about to be sent whether the
+// body is compressed. Compressed bodies are always sent chunked since their
+// length is not known until the end.
+func (writer *Writer) setupCompression() {
+	if !writer.compressionEnabled {
+		return
+	}
+
+	// These responses never carry a body
+	status := writer.StatusCode
+	if !bodyAllowed(status) {
+		return
+	}
+
+	// Byte ranges refer to the uncompressed representation
+	h := writer.Headers
+	if status == StatusPartialContent || status == StatusRangeNotSatisfiable || h.Get("content-range") != "" {
+		return
+	}
+
+	if !compressible(h.Get("content-type")) || h.Get("content-encoding") != "" {
+		return
+	}
+
+	// The response differs by Accept-Encoding from here on
+	vary := h.Get("vary")
+	if vary == "" {
+		h.Set("vary", "Accept-Encoding")
+	} else if !strings.Contains(strings.ToLower(vary), "accept-encoding") && vary != "*" {
+		h.Set("vary", vary+", Accept-Encoding")
+	}
+
+	// With no acceptable coding the body goes out as is even if identity
+	// was ruled out, the status line is already sent. server.Compress
+	// answers those requests with 406 before the handler runs.
+	encoding, identityOk := NegotiateEncoding(writer.acceptEncoding)
+	if encoding == "" {
+		return
+	}
+
+	minSize := writer.CompressionMinSize
+	if minSize <= 0 {
+		minSize = DefaultCompressionMinSize
+	}
+	if identityOk && writer.contentLength >= 0 && writer.contentLength < int64(minSize) {
+		return
+	}
+
+	sink := chunkWriter{w: writer.bodyOut()}
+	switch encoding {
+	case "gzip":
+		writer.compressor = gzip.NewWriter(sink)
+	case "deflate":
+		writer.compressor = zlib.NewWriter(sink)
+	}
+
+	h.Delete("content-length")
+	h.Set("transfer-encoding", "chunked")
+	h.Set("content-encoding", encoding)
+
+	// The encoded bytes differ from the identity ones a strong tag names,
+	// which would break If-Match and If-Range
+	if etag := h.Get("etag"); strings.HasPrefix(etag, "\"") {
+		h.Set("etag", "W/"+etag)
+	}
+}
+
+// finishCompression flushes the compressed stream and ends a body whose
+// handler did not declare chunked encoding itself. It went out chunked so
+// the declared trailers follow as they would for a chunked body.
+func (writer *Writer) finishCompression() error {
+	if err := writer.compressor.Close(); err != nil {
+		return err
+	}
+
+	if _, err := writer.bodyOut().Write([]byte("0\r\n")); err != nil {
+		return err
+	}
+
+	writer.chunked = true
+	writer.writerState = WritingTrailers
+	return writer.WriteTrailers(writer.Trailers)
+}
+
+type chunkWriter struct {
+	w io.Writer
+}
+
+func (c chunkWriter) Write(p []byte) (int, error) {
+	if _, err := writeChunk(c.w, p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
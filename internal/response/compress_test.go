@@ -0,0 +1,149 @@
+package response
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	// Test: No Accept-Encoding
+	encoding, identityOk := NegotiateEncoding("")
+	assert.Equal(t, "", encoding)
+	assert.True(t, identityOk)
+
+	// Test: Prefer gzip on a tie
+	encoding, _ = NegotiateEncoding("deflate, gzip")
+	assert.Equal(t, "gzip", encoding)
+
+	// Test: Higher q-value wins
+	encoding, _ = NegotiateEncoding("gzip;q=0.5, deflate;q=0.8")
+	assert.Equal(t, "deflate", encoding)
+
+	// Test: Coding ruled out with q=0
+	encoding, _ = NegotiateEncoding("gzip;q=0, br")
+	assert.Equal(t, "", encoding)
+
+	// Test: Wildcard
+	encoding, _ = NegotiateEncoding("*")
+	assert.Equal(t, "gzip", encoding)
+
+	// Test: Identity ruled out
+	encoding, identityOk = NegotiateEncoding("gzip, identity;q=0")
+	assert.Equal(t, "gzip", encoding)
+	assert.False(t, identityOk)
+}
+
+func TestWriterCompression(t *testing.T) {
+	body := strings.Repeat("<p>hello world</p>", 100)
+
+	// Test: Large html body is gzipped and chunked
+	buf := &bytes.Buffer{}
+	w := &Writer{W: buf}
+	w.EnableCompression("gzip")
+	w.Header().Set("content-type", "text/html")
+	_, err := w.Write([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	head, wire, _ := strings.Cut(buf.String(), "\r\n\r\n")
+	assert.Contains(t, head, "content-encoding: gzip")
+	assert.Contains(t, head, "transfer-encoding: chunked")
+	assert.Contains(t, head, "vary: Accept-Encoding")
+	assert.NotContains(t, head, "content-length")
+	gz, err := gzip.NewReader(bytes.NewReader(dechunk(t, wire)))
+	require.NoError(t, err)
+	decoded, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Equal(t, body, string(decoded))
+
+	// Test: Explicit content-length response is compressed too
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	w.EnableCompression("gzip")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(len(body))))
+	require.NoError(t, w.WriteBody([]byte(body)))
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "content-encoding: gzip")
+	assert.True(t, strings.HasSuffix(buf.String(), "0\r\n\r\n"))
+
+	// Test: Declared trailers follow a compressed content-length body
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	w.EnableCompression("gzip")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	h := GetDefaultHeaders(len(body))
+	h.Set("trailer", "X-Checksum")
+	require.NoError(t, w.WriteHeaders(h))
+	require.NoError(t, w.WriteBody([]byte(body)))
+	w.Trailers = GetDefaultTrailers()
+	w.Trailers.Set("X-Checksum", "abc")
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "trailer: x-checksum\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "0\r\nx-checksum: abc\r\n\r\n"))
+
+	// Test: Strong ETag is weakened, weak ones kept
+	for etag, want := range map[string]string{`"v1"`: `W/"v1"`, `W/"v1"`: `W/"v1"`} {
+		buf = &bytes.Buffer{}
+		w = &Writer{W: buf}
+		w.EnableCompression("gzip")
+		w.Header().Set("etag", etag)
+		_, err = w.Write([]byte(body))
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		assert.Contains(t, buf.String(), "etag: "+want+"\r\n")
+	}
+
+	// Test: Tiny body is sent as is
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	w.EnableCompression("gzip")
+	_, err = w.Write([]byte("tiny"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.NotContains(t, buf.String(), "content-encoding")
+	assert.Contains(t, buf.String(), "vary: Accept-Encoding")
+	assert.Contains(t, buf.String(), "content-length: 4")
+
+	// Test: Tiny body compressed when identity is ruled out
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	w.EnableCompression("gzip, identity;q=0")
+	_, err = w.Write([]byte("tiny"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "content-encoding: gzip")
+
+	// Test: Already compressed media type
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	w.EnableCompression("gzip")
+	w.Header().Set("content-type", "video/mp4")
+	_, err = w.Write([]byte(body))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.NotContains(t, buf.String(), "content-encoding")
+	assert.NotContains(t, buf.String(), "vary")
+}
+
+func dechunk(t *testing.T, wire string) []byte {
+	var body []byte
+	for {
+		sizeLine, rest, ok := strings.Cut(wire, "\r\n")
+		require.True(t, ok)
+		var size int
+		_, err := fmt.Sscanf(sizeLine, "%x", &size)
+		require.NoError(t, err)
+		if size == 0 {
+			return body
+		}
+		body = append(body, rest[:size]...)
+		wire = rest[size+2:]
+	}
+}
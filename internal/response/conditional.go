@@ -0,0 +1,145 @@
+package response
+
+import (
+	"strings"
+	"time"
+
+	"github.com/TJ-R/httpfromtcp/internal/request"
+)
+
+// SetETag declares the entity tag of the representation being sent. The tag
+// is quoted here, weak tags get the W/ prefix.
+func (writer *Writer) SetETag(tag string, weak bool) {
+	etag := "\"" + tag + "\""
+	if weak {
+		etag = "W/" + etag
+	}
+
+	writer.Header().Set("etag", etag)
+}
+
+// SetLastModified declares when the representation last changed
+func (writer *Writer) SetLastModified(t time.Time) {
+	writer.Header().Set("last-modified", t.UTC().Format(TimeFormat))
+}
+
+// CheckPreconditions evaluates If-Match, If-Unmodified-Since, If-None-Match
+// and If-Modified-Since against the etag and last-modified already set on
+// w.Header(), in the order given by RFC 9110 section 13.2.2. Calling it
+// means the resource has a current representation, so "*" always matches.
+// When a precondition decides the response it sets 304 Not Modified or 412
+// Precondition Failed and returns true, the handler should then not write a
+// body.
+func CheckPreconditions(w *Writer, req *request.Request) bool {
+	if req == nil {
+		return false
+	}
+
+	h := w.Header()
+	etag := h.Get("etag")
+	lastModified, hasLastModified := parseHTTPDate(h.Get("last-modified"))
+	method := req.RequestLine.Method
+
+	if ifMatch := req.Get("If-Match"); ifMatch != "" {
+		if !etagListMatches(ifMatch, etag, true) {
+			w.SetStatus(StatusPreconditionFailed)
+			return true
+		}
+	} else if since, ok := parseHTTPDate(req.Get("If-Unmodified-Since")); ok && hasLastModified {
+		if lastModified.After(since) {
+			w.SetStatus(StatusPreconditionFailed)
+			return true
+		}
+	}
+
+	if ifNoneMatch := req.Get("If-None-Match"); ifNoneMatch != "" {
+		if etagListMatches(ifNoneMatch, etag, false) {
+			if method == "GET" || method == "HEAD" {
+				w.SetStatus(StatusNotModified)
+			} else {
+				w.SetStatus(StatusPreconditionFailed)
+			}
+			return true
+		}
+	} else if since, ok := parseHTTPDate(req.Get("If-Modified-Since")); ok && hasLastModified {
+		if (method == "GET" || method == "HEAD") && !lastModified.After(since) {
+			w.SetStatus(StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+// etagListMatches reports whether etag is in an If-Match or If-None-Match
+// list. If-Match uses strong comparison, If-None-Match weak comparison. "*"
+// matches any current representation, with or without an etag (RFC 9110
+// section 13.1.1 and 13.1.2).
+func etagListMatches(list string, etag string, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	if etag == "" {
+		return false
+	}
+
+	for _, candidate := range splitETags(list) {
+		if strong {
+			if !strings.HasPrefix(candidate, "W/") && !strings.HasPrefix(etag, "W/") && candidate == etag {
+				return true
+			}
+			continue
+		}
+
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitETags splits a comma separated list of entity tags. Commas are valid
+// inside the quotes so a plain split is not enough.
+func splitETags(list string) []string {
+	var etags []string
+	inQuotes := false
+	start := 0
+
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '"':
+			inQuotes = !inQuotes
+		case ',':
+			if !inQuotes {
+				if etag := strings.TrimSpace(list[start:i]); etag != "" {
+					etags = append(etags, etag)
+				}
+				start = i + 1
+			}
+		}
+	}
+
+	if etag := strings.TrimSpace(list[start:]); etag != "" {
+		etags = append(etags, etag)
+	}
+
+	return etags
+}
+
+// parseHTTPDate accepts the IMF-fixdate format and the two obsolete formats
+// recipients must still understand
+func parseHTTPDate(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range []string{TimeFormat, time.RFC850, time.ANSIC} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
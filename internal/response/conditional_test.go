@@ -0,0 +1,100 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPreconditions(t *testing.T) {
+	modified := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+	before := modified.Add(-time.Hour).Format(TimeFormat)
+	after := modified.Add(time.Hour).Format(TimeFormat)
+
+	// Test: No conditional headers
+	w := validatedWriter(modified)
+	assert.False(t, CheckPreconditions(w, conditionalRequest("GET")))
+
+	// Test: If-None-Match hit on GET
+	w = validatedWriter(modified)
+	assert.True(t, CheckPreconditions(w, conditionalRequest("GET", "If-None-Match", `"other", W/"v1"`)))
+	assert.Equal(t, StatusNotModified, w.StatusCode)
+
+	// Test: If-None-Match hit on POST
+	w = validatedWriter(modified)
+	assert.True(t, CheckPreconditions(w, conditionalRequest("POST", "If-None-Match", "*")))
+	assert.Equal(t, StatusPreconditionFailed, w.StatusCode)
+
+	// Test: If-None-Match * matches a representation without an etag
+	w = &Writer{}
+	assert.True(t, CheckPreconditions(w, conditionalRequest("GET", "If-None-Match", "*")))
+	assert.Equal(t, StatusNotModified, w.StatusCode)
+
+	// Test: If-None-Match miss ignores If-Modified-Since
+	w = validatedWriter(modified)
+	assert.False(t, CheckPreconditions(w, conditionalRequest("GET", "If-None-Match", `"v2"`, "If-Modified-Since", after)))
+
+	// Test: If-Modified-Since
+	w = validatedWriter(modified)
+	assert.True(t, CheckPreconditions(w, conditionalRequest("GET", "If-Modified-Since", after)))
+	assert.Equal(t, StatusNotModified, w.StatusCode)
+	w = validatedWriter(modified)
+	assert.False(t, CheckPreconditions(w, conditionalRequest("GET", "If-Modified-Since", before)))
+
+	// Test: If-Match uses strong comparison
+	w = validatedWriter(modified)
+	assert.False(t, CheckPreconditions(w, conditionalRequest("PUT", "If-Match", `"v1"`)))
+	w = validatedWriter(modified)
+	assert.True(t, CheckPreconditions(w, conditionalRequest("PUT", "If-Match", `W/"v1"`)))
+	assert.Equal(t, StatusPreconditionFailed, w.StatusCode)
+
+	// Test: If-Unmodified-Since
+	w = validatedWriter(modified)
+	assert.True(t, CheckPreconditions(w, conditionalRequest("PUT", "If-Unmodified-Since", before)))
+	assert.Equal(t, StatusPreconditionFailed, w.StatusCode)
+
+	// Test: If-Match takes precedence over If-Unmodified-Since
+	w = validatedWriter(modified)
+	assert.False(t, CheckPreconditions(w, conditionalRequest("PUT", "If-Match", `"v1"`, "If-Unmodified-Since", before)))
+
+	// Test: Entity tags containing commas
+	assert.Equal(t, []string{`"a,b"`, `W/"c"`}, splitETags(`"a,b", W/"c"`))
+}
+
+func TestServeContentNotModified(t *testing.T) {
+	// Test: 304 has validators but no body or framing
+	buf := &bytes.Buffer{}
+	w := &Writer{W: buf}
+	w.SetETag("v1", false)
+	w.Header().Set("content-type", "text/plain")
+	require.NoError(t, ServeContent(w, conditionalRequest("GET", "If-None-Match", `"v1"`), strings.NewReader("body")))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 304 Not Modified\r\n"))
+	assert.Contains(t, buf.String(), "etag: \"v1\"\r\n")
+	assert.NotContains(t, buf.String(), "content-length")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+}
+
+func validatedWriter(modified time.Time) *Writer {
+	w := &Writer{W: &bytes.Buffer{}}
+	w.SetETag("v1", false)
+	w.SetLastModified(modified)
+	return w
+}
+
+func conditionalRequest(method string, pairs ...string) *request.Request {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: "/", HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		req.Headers.Set(pairs[i], pairs[i+1])
+	}
+	return req
+}
@@ -0,0 +1,55 @@
+package response
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+)
+
+// DefaultServerToken is sent in the server header when the writer's
+// ServerToken is empty.
+const DefaultServerToken = "httpfromtcp"
+
+// IMF-fixdate from RFC 9110 section 5.6.7
+const TimeFormat = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+type cachedDate struct {
+	unix  int64
+	value string
+}
+
+var dateCache atomic.Pointer[cachedDate]
+
+// httpDate formats now as an IMF-fixdate, reusing the previous value while
+// the second has not changed.
+func httpDate(now time.Time) string {
+	unix := now.Unix()
+	if cached := dateCache.Load(); cached != nil && cached.unix == unix {
+		return cached.value
+	}
+
+	value := now.UTC().Format(TimeFormat)
+	dateCache.Store(&cachedDate{unix: unix, value: value})
+	return value
+}
+
+// addDateAndServer fills in the date and server headers unless the handler
+// set them. Setting either to an empty value leaves it off the response.
+func (writer *Writer) addDateAndServer(h headers.Headers) {
+	if value, ok := h.Lookup("date"); !ok {
+		h.Set("date", httpDate(time.Now()))
+	} else if value == "" {
+		h.Delete("date")
+	}
+
+	if value, ok := h.Lookup("server"); !ok {
+		token := writer.ServerToken
+		if token == "" {
+			token = DefaultServerToken
+		}
+		h.Set("server", token)
+	} else if value == "" {
+		h.Delete("server")
+	}
+}
@@ -0,0 +1,49 @@
+package response
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDateAndServer(t *testing.T) {
+	// Test: IMF-fixdate format
+	now := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", httpDate(now))
+
+	// Test: Cached within the same second
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:37 GMT", httpDate(now.Add(500*time.Millisecond)))
+	assert.Equal(t, "Sun, 06 Nov 1994 08:49:38 GMT", httpDate(now.Add(time.Second)))
+
+	// Test: Added by default
+	buf := &bytes.Buffer{}
+	w := &Writer{W: buf}
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "date: ")
+	assert.Contains(t, buf.String(), "server: httpfromtcp\r\n")
+
+	// Test: Configured server token
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf, ServerToken: "teapot/1.0"}
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "server: teapot/1.0\r\n")
+
+	// Test: Set by handler
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	w.Header().Set("Date", "Sun, 06 Nov 1994 08:49:37 GMT")
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "date: Sun, 06 Nov 1994 08:49:37 GMT\r\n")
+
+	// Test: Suppressed by handler
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	w.Header()["Date"] = ""
+	w.Header()["Server"] = ""
+	require.NoError(t, w.Close())
+	assert.NotContains(t, buf.String(), "date:")
+	assert.NotContains(t, buf.String(), "server:")
+}
@@ -0,0 +1,69 @@
+package response
+
+import (
+	"bufio"
+	"errors"
+	"net"
+)
+
+var (
+	ErrNotHijackable = errors.New("Connection cannot be hijacked")
+	ErrHijacked      = errors.New("Connection has been hijacked")
+)
+
+// Hijacker is implemented by response writers that can hand the underlying
+// connection over to the handler.
+type Hijacker interface {
+	Hijack() (net.Conn, *bufio.ReadWriter, error)
+}
+
+// HijackFunc returns the connection behind a Writer along with a reader
+// holding any bytes already read past the request
+type HijackFunc func() (net.Conn, *bufio.ReadWriter, error)
+
+// EnableHijack is called by the server to make the connection behind the
+// writer available through Hijack.
+func (writer *Writer) EnableHijack(hijack HijackFunc) {
+	writer.hijack = hijack
+}
+
+// Hijack takes the connection over from the server. Anything already written
+// to the response is flushed first, after that the writer can no longer be
+// used and the server neither finishes the response nor closes the
+// connection.
+func (writer *Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if writer.hijacked {
+		return nil, nil, ErrHijacked
+	}
+
+	if writer.hijack == nil {
+		return nil, nil, ErrNotHijackable
+	}
+
+	if f, ok := writer.W.(Flusher); ok {
+		if err := f.Flush(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	conn, rw, err := writer.hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	writer.hijacked = true
+	writer.writerState = WritingDone
+	writer.W = hijackedWriter{}
+
+	return conn, rw, nil
+}
+
+func (writer *Writer) Hijacked() bool {
+	return writer.hijacked
+}
+
+type hijackedWriter struct{}
+
+func (hijackedWriter) Write(p []byte) (int, error) {
+	return 0, ErrHijacked
+}
@@ -0,0 +1,45 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterHijack(t *testing.T) {
+	// Test: Writer without a connection
+	w := &Writer{W: &bytes.Buffer{}}
+	_, _, err := w.Hijack()
+	require.ErrorIs(t, err, ErrNotHijackable)
+
+	// Test: Buffered output is flushed before the connection is handed over
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	buf := &bytes.Buffer{}
+	bw := bufio.NewWriter(buf)
+	w = &Writer{W: bw}
+	w.EnableHijack(func() (net.Conn, *bufio.ReadWriter, error) {
+		return server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)), nil
+	})
+	require.NoError(t, w.WriteStatusLine(StatusSwitchingProtocols))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(0)))
+
+	conn, rw, err := w.Hijack()
+	require.NoError(t, err)
+	assert.Equal(t, server, conn)
+	assert.NotNil(t, rw)
+	assert.True(t, w.Hijacked())
+	assert.Contains(t, buf.String(), "HTTP/1.1 101 Switching Protocols\r\n")
+
+	// Test: Writer is unusable afterwards
+	_, err = w.Write([]byte("late"))
+	require.Error(t, err)
+	_, _, err = w.Hijack()
+	require.ErrorIs(t, err, ErrHijacked)
+}
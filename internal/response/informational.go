@@ -0,0 +1,56 @@
+package response
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+)
+
+// WriteInformational sends an interim 1xx response with its own headers
+// ahead of the final status line. It can be called any number of times
+// before the response is started and is flushed straight to the client.
+// 101 Switching Protocols is final and goes through WriteStatusLine.
+func (writer *Writer) WriteInformational(statusCode StatusCode, h headers.Headers) error {
+	if writer.writerState != WritingStatus {
+		return fmt.Errorf("Informational responses must come before the StatusLine")
+	}
+
+	if statusCode < 100 || statusCode > 199 || statusCode == StatusSwitchingProtocols {
+		return fmt.Errorf("Invalid informational status code: %d", statusCode)
+	}
+
+	_, err := writer.W.Write([]byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, StatusText(statusCode))))
+	if err != nil {
+		return err
+	}
+
+	for k, v := range h {
+		_, err := writer.W.Write([]byte(k + ": " + v + "\r\n"))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = writer.W.Write([]byte("\r\n"))
+	if err != nil {
+		return err
+	}
+
+	// The point of an interim response is that it arrives early
+	if f, ok := writer.W.(Flusher); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
+// WriteEarlyHints sends 103 Early Hints with the given link values, such as
+// `</style.css>; rel=preload; as=style`, so the client can start fetching
+// them while the final response is prepared.
+func (writer *Writer) WriteEarlyHints(links ...string) error {
+	h := headers.NewHeaders()
+	h.Set("link", strings.Join(links, ", "))
+
+	return writer.WriteInformational(StatusEarlyHints, h)
+}
@@ -0,0 +1,42 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterInformational(t *testing.T) {
+	// Test: Early hints and processing before the final response
+	buf := &bytes.Buffer{}
+	w := &Writer{W: buf}
+	require.NoError(t, w.WriteEarlyHints("</style.css>; rel=preload; as=style", "</app.js>; rel=preload; as=script"))
+	require.NoError(t, w.WriteInformational(StatusProcessing, headers.NewHeaders()))
+	w.Write([]byte("done"))
+	require.NoError(t, w.Close())
+
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 103 Early Hints\r\nlink: </style.css>; rel=preload; as=style, </app.js>; rel=preload; as=script\r\n\r\nHTTP/1.1 102 Processing\r\n\r\nHTTP/1.1 200 OK\r\n"))
+
+	res, err := ResponseFromReader(buf)
+	require.NoError(t, err)
+	assert.Equal(t, StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "done", string(res.Body))
+	require.Len(t, res.Informational, 2)
+	assert.Equal(t, StatusEarlyHints, res.Informational[0].StatusLine.StatusCode)
+	assert.Contains(t, res.Informational[0].Headers.Get("Link"), "rel=preload")
+	assert.Equal(t, StatusProcessing, res.Informational[1].StatusLine.StatusCode)
+
+	// Test: Final status and 101 are rejected
+	w = &Writer{W: &bytes.Buffer{}}
+	require.Error(t, w.WriteInformational(StatusOk, nil))
+	require.Error(t, w.WriteInformational(StatusSwitchingProtocols, nil))
+
+	// Test: Too late once the status line is out
+	w = &Writer{W: &bytes.Buffer{}}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.Error(t, w.WriteEarlyHints("</style.css>; rel=preload"))
+}
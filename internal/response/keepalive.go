@@ -0,0 +1,32 @@
+package response
+
+import (
+	"strings"
+)
+
+// KeepsAlive reports whether the connection can be reused once the response
+// is finished. That needs KeepAlive, no connection: close from the handler
+// and a body the client can find the end of without the connection closing.
+func (writer *Writer) KeepsAlive() bool {
+	if !writer.KeepAlive || writer.hijacked || writer.writerState != WritingDone {
+		return false
+	}
+
+	if HasToken(writer.Headers.Get("connection"), "close") {
+		return false
+	}
+
+	return writer.chunked || writer.compressor != nil || writer.contentLength >= 0 || writer.noBody()
+}
+
+// HasToken reports whether a comma separated header value such as
+// Connection contains token, ignoring case
+func HasToken(value, token string) bool {
+	for _, part := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(part), token) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,71 @@
+package response
+
+import (
+	"strconv"
+	"strings"
+)
+
+// NegotiateType picks the offer the Accept value ranks highest, matching
+// the most specific media range for each. Ties go to the earlier offer and
+// an empty Accept takes the first. "" means none of the offers is
+// acceptable.
+func NegotiateType(accept string, offers ...string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	ranges := parseQValues(accept)
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		mediaType := strings.ToLower(offer)
+		major, _, _ := strings.Cut(mediaType, "/")
+
+		q, ok := ranges[mediaType]
+		if !ok {
+			q, ok = ranges[major+"/*"]
+		}
+		if !ok {
+			q = ranges["*/*"]
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best
+}
+
+// parseQValues maps each lowercased value in a comma separated list such
+// as Accept or Accept-Encoding to its q-value, 1 when it has none.
+// Parameters other than q are ignored.
+func parseQValues(header string) map[string]float64 {
+	qvalues := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(part, ";")
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, paramValue, ok := strings.Cut(param, "=")
+			if !ok || !strings.EqualFold(strings.TrimSpace(name), "q") {
+				continue
+			}
+
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(paramValue), 64)
+			if err == nil {
+				q = parsed
+			}
+		}
+
+		qvalues[value] = q
+	}
+
+	return qvalues
+}
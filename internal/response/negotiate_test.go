@@ -0,0 +1,30 @@
+package response
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateType(t *testing.T) {
+	offers := []string{"text/plain", "text/html", "application/json"}
+
+	// Test: No Accept takes the first offer
+	assert.Equal(t, "text/plain", NegotiateType("", offers...))
+
+	// Test: Wildcard ties go to the earlier offer
+	assert.Equal(t, "text/plain", NegotiateType("*/*", offers...))
+
+	// Test: Higher q-value wins
+	assert.Equal(t, "application/json", NegotiateType("text/*;q=0.5, application/json", offers...))
+
+	// Test: Browser Accept prefers HTML
+	assert.Equal(t, "text/html", NegotiateType("text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", offers...))
+
+	// Test: The most specific range counts, case insensitive
+	assert.Equal(t, "text/html", NegotiateType("Text/*, text/plain;q=0", offers...))
+
+	// Test: Nothing acceptable
+	assert.Equal(t, "", NegotiateType("image/png", offers...))
+	assert.Equal(t, "", NegotiateType("*/*;q=0", offers...))
+}
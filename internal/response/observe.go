@@ -0,0 +1,37 @@
+package response
+
+import (
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+)
+
+// Observer is told what a handler writes through a Writer, so middleware can
+// log or measure responses without changing how they are written.
+type Observer interface {
+	// WroteHeaders is called once the status line and headers are sent
+	WroteHeaders(statusCode StatusCode, h headers.Headers)
+
+	// WroteBody is called with the size of each piece of body written,
+	// counted before compression
+	WroteBody(n int64)
+}
+
+func (writer *Writer) Observe(o Observer) {
+	writer.observers = append(writer.observers, o)
+}
+
+func (writer *Writer) countBody(n int64) {
+	writer.bodyWritten += n
+	if n == 0 {
+		return
+	}
+
+	for _, o := range writer.observers {
+		o.WroteBody(n)
+	}
+}
+
+// onClose registers f to run when Close is called, before the response is
+// finished, so helpers writing from other goroutines can stop first
+func (writer *Writer) onClose(f func()) {
+	writer.closeHooks = append(writer.closeHooks, f)
+}
@@ -0,0 +1,232 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+	"github.com/TJ-R/httpfromtcp/internal/request"
+)
+
+// Requests asking for more ranges than this are served in full
+const maxRanges = 100
+
+var (
+	ErrInvalidRange = errors.New("Invalid range")
+	ErrNoOverlap    = errors.New("Range does not overlap content")
+)
+
+// Range is a satisfiable byte range within content of a known size
+type Range struct {
+	Start  int64
+	Length int64
+}
+
+func (r Range) ContentRange(size int64) string {
+	return fmt.Sprintf("bytes %d-%d/%d", r.Start, r.Start+r.Length-1, size)
+}
+
+// ParseRange parses a Range header value against content of the given size.
+// Unsatisfiable ranges are dropped, ErrNoOverlap is returned when none are
+// left.
+func ParseRange(header string, size int64) ([]Range, error) {
+	unit, specs, ok := strings.Cut(header, "=")
+	if !ok || strings.TrimSpace(unit) != "bytes" {
+		return nil, ErrInvalidRange
+	}
+
+	var ranges []Range
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+
+		first, last, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, ErrInvalidRange
+		}
+		first, last = strings.TrimSpace(first), strings.TrimSpace(last)
+
+		if first == "" {
+			// Suffix range, the final last bytes of the content
+			suffix, err := strconv.ParseInt(last, 10, 64)
+			if err != nil || suffix < 0 {
+				return nil, ErrInvalidRange
+			}
+			if suffix == 0 || size == 0 {
+				continue
+			}
+
+			suffix = min(suffix, size)
+			ranges = append(ranges, Range{Start: size - suffix, Length: suffix})
+			continue
+		}
+
+		start, err := strconv.ParseInt(first, 10, 64)
+		if err != nil || start < 0 {
+			return nil, ErrInvalidRange
+		}
+
+		end := size - 1
+		if last != "" {
+			end, err = strconv.ParseInt(last, 10, 64)
+			if err != nil || end < start {
+				return nil, ErrInvalidRange
+			}
+			end = min(end, size-1)
+		}
+
+		if start >= size {
+			continue
+		}
+
+		ranges = append(ranges, Range{Start: start, Length: end - start + 1})
+	}
+
+	if len(ranges) == 0 {
+		return nil, ErrNoOverlap
+	}
+
+	return ranges, nil
+}
+
+// ifRangeMatches reports whether an If-Range value still identifies the
+// current representation, either by strong etag or exact last-modified date.
+func ifRangeMatches(ifRange string, h headers.Headers) bool {
+	etag, lastModified := h.Get("etag"), h.Get("last-modified")
+
+	if strings.HasPrefix(ifRange, "\"") || strings.HasPrefix(ifRange, "W/") {
+		return etag != "" && !strings.HasPrefix(etag, "W/") && ifRange == etag
+	}
+
+	if lastModified == "" {
+		return false
+	}
+
+	ifRangeTime, ok := parseHTTPDate(ifRange)
+	if !ok {
+		return false
+	}
+	lastModifiedTime, ok := parseHTTPDate(lastModified)
+	if !ok {
+		return false
+	}
+
+	return ifRangeTime.Equal(lastModifiedTime)
+}
+
+// ServeContent writes content as the response body, answering Range
+// requests with 206 Partial Content, multipart/byteranges or 416. The
+// content-type and any etag or last-modified validators should be set on
+// w.Header() first, they are used for the parts, to check If-Range and to
+// answer conditional requests with 304 or 412.
+func ServeContent(w *Writer, req *request.Request, content io.ReadSeeker) error {
+	if CheckPreconditions(w, req) {
+		return nil
+	}
+
+	size, err := content.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	h := w.Header()
+	h.Set("accept-ranges", "bytes")
+
+	ranges := requestedRanges(w, req, size)
+	if ranges == nil {
+		h.Set("content-length", strconv.FormatInt(size, 10))
+		_, err := io.CopyN(w, content, size)
+		return err
+	}
+
+	if len(ranges) == 0 {
+		w.SetStatus(StatusRangeNotSatisfiable)
+		h.Set("content-range", fmt.Sprintf("bytes */%d", size))
+		h.Set("content-length", "0")
+		return nil
+	}
+
+	w.SetStatus(StatusPartialContent)
+
+	if len(ranges) == 1 {
+		r := ranges[0]
+		h.Set("content-range", r.ContentRange(size))
+		h.Set("content-length", strconv.FormatInt(r.Length, 10))
+		if _, err := content.Seek(r.Start, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := io.CopyN(w, content, r.Length)
+		return err
+	}
+
+	contentType := h.Get("content-type")
+	mw := multipart.NewWriter(w)
+	h.Set("content-type", "multipart/byteranges; boundary="+mw.Boundary())
+	for _, r := range ranges {
+		partHeader := textproto.MIMEHeader{}
+		if contentType != "" {
+			partHeader.Set("Content-Type", contentType)
+		}
+		partHeader.Set("Content-Range", r.ContentRange(size))
+
+		part, err := mw.CreatePart(partHeader)
+		if err != nil {
+			return err
+		}
+		if _, err := content.Seek(r.Start, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.CopyN(part, content, r.Length); err != nil {
+			return err
+		}
+	}
+
+	return mw.Close()
+}
+
+// requestedRanges returns nil when the full content should be sent and an
+// empty slice when the request cannot be satisfied.
+func requestedRanges(w *Writer, req *request.Request, size int64) []Range {
+	if req == nil || req.RequestLine.Method != "GET" {
+		return nil
+	}
+
+	rangeHeader := req.Get("Range")
+	if rangeHeader == "" {
+		return nil
+	}
+
+	if ifRange := req.Get("If-Range"); ifRange != "" && !ifRangeMatches(ifRange, w.Header()) {
+		return nil
+	}
+
+	ranges, err := ParseRange(rangeHeader, size)
+	if errors.Is(err, ErrNoOverlap) {
+		return []Range{}
+	}
+	if err != nil || len(ranges) > maxRanges {
+		return nil
+	}
+
+	// Overlapping ranges adding up to more than the content are not worth
+	// answering piecemeal
+	var total int64
+	for _, r := range ranges {
+		total += r.Length
+	}
+	if total > size {
+		return nil
+	}
+
+	return ranges
+}
@@ -0,0 +1,132 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRange(t *testing.T) {
+	// Test: Single range
+	ranges, err := ParseRange("bytes=0-4", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []Range{{Start: 0, Length: 5}}, ranges)
+
+	// Test: Open ended and suffix ranges
+	ranges, err = ParseRange("bytes=8-, -3", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []Range{{Start: 8, Length: 2}, {Start: 7, Length: 3}}, ranges)
+
+	// Test: End past the content is clamped
+	ranges, err = ParseRange("bytes=5-100", 10)
+	require.NoError(t, err)
+	assert.Equal(t, []Range{{Start: 5, Length: 5}}, ranges)
+
+	// Test: Unsatisfiable
+	_, err = ParseRange("bytes=10-20", 10)
+	assert.ErrorIs(t, err, ErrNoOverlap)
+
+	// Test: Malformed
+	_, err = ParseRange("bytes=5-2", 10)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+	_, err = ParseRange("items=0-1", 10)
+	assert.ErrorIs(t, err, ErrInvalidRange)
+}
+
+func TestServeContent(t *testing.T) {
+	content := "0123456789"
+
+	// Test: No Range sends everything
+	buf := &bytes.Buffer{}
+	w := &Writer{W: buf}
+	require.NoError(t, ServeContent(w, rangeRequest("", ""), strings.NewReader(content)))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, buf.String(), "accept-ranges: bytes\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"+content))
+
+	// Test: HEAD gets the length without the content being read
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf, SuppressBody: true}
+	unread := &countingReader{ReadSeeker: strings.NewReader(content)}
+	require.NoError(t, ServeContent(w, rangeRequest("", ""), unread))
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "content-length: 10\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+	assert.Zero(t, unread.reads)
+
+	// Test: Single range
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	require.NoError(t, ServeContent(w, rangeRequest("bytes=2-4", ""), strings.NewReader(content)))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 206 Partial Content\r\n"))
+	assert.Contains(t, buf.String(), "content-range: bytes 2-4/10\r\n")
+	assert.Contains(t, buf.String(), "content-length: 3\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n234"))
+
+	// Test: Multiple ranges
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	w.Header().Set("content-type", "text/plain")
+	require.NoError(t, ServeContent(w, rangeRequest("bytes=0-1, 8-9", ""), strings.NewReader(content)))
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "content-type: multipart/byteranges; boundary=")
+	assert.Contains(t, buf.String(), "Content-Range: bytes 0-1/10\r\nContent-Type: text/plain\r\n\r\n01\r\n")
+	assert.Contains(t, buf.String(), "Content-Range: bytes 8-9/10\r\nContent-Type: text/plain\r\n\r\n89\r\n")
+
+	// Test: Unsatisfiable range
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	require.NoError(t, ServeContent(w, rangeRequest("bytes=20-", ""), strings.NewReader(content)))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 416 Range Not Satisfiable\r\n"))
+	assert.Contains(t, buf.String(), "content-range: bytes */10\r\n")
+
+	// Test: If-Range with a matching etag
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	w.Header().Set("etag", `"v1"`)
+	require.NoError(t, ServeContent(w, rangeRequest("bytes=0-0", `"v1"`), strings.NewReader(content)))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 206 Partial Content\r\n"))
+
+	// Test: If-Range with a stale etag sends everything
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	w.Header().Set("etag", `"v2"`)
+	require.NoError(t, ServeContent(w, rangeRequest("bytes=0-0", `"v1"`), strings.NewReader(content)))
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"+content))
+}
+
+func rangeRequest(rangeHeader, ifRange string) *request.Request {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/", HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	if rangeHeader != "" {
+		req.Headers.Set("range", rangeHeader)
+	}
+	if ifRange != "" {
+		req.Headers.Set("if-range", ifRange)
+	}
+	return req
+}
+
+type countingReader struct {
+	io.ReadSeeker
+	reads int
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	r.reads++
+	return r.ReadSeeker.Read(p)
+}
@@ -0,0 +1,388 @@
+package response
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+)
+
+const readBufferSize = 8
+
+type Response struct {
+	StatusLine  StatusLine
+	parserState ResponseParserState
+	Headers     headers.Headers
+	Body        []byte
+	Trailers    headers.Headers
+
+	// Interim 1xx responses received before the final one, in order
+	Informational []InformationalResponse
+
+	// Bytes read from the reader past the end of this response
+	leftover []byte
+
+	// Method of the request this is a response to, HEAD responses have
+	// no body whatever their headers say
+	requestMethod  string
+	bodyRemaining  int64
+	closeDelimited bool
+}
+
+type InformationalResponse struct {
+	StatusLine StatusLine
+	Headers    headers.Headers
+}
+
+type StatusLine struct {
+	HttpVersion  string
+	StatusCode   StatusCode
+	ReasonPhrase string
+}
+
+type ResponseParserState int
+
+const (
+	ResponseStateParsingStatusLine ResponseParserState = iota
+	ResponseStateParsingHeaders
+	ResponseStateParsingBody
+	ResponseStateParsingChunkSize
+	ResponseStateParsingChunkData
+	ResponseStateParsingChunkEnd
+	ResponseStateParsingTrailers
+	ResponseStateDone
+)
+
+func (p ResponseParserState) String() string {
+	switch p {
+	case ResponseStateParsingStatusLine:
+		return "Parsing Status Line"
+	case ResponseStateParsingHeaders:
+		return "Parsing Headers"
+	case ResponseStateParsingBody:
+		return "Parsing Body"
+	case ResponseStateParsingChunkSize:
+		return "Parsing Chunk Size"
+	case ResponseStateParsingChunkData:
+		return "Parsing Chunk Data"
+	case ResponseStateParsingChunkEnd:
+		return "Parsing Chunk End"
+	case ResponseStateParsingTrailers:
+		return "Parsing Trailers"
+	case ResponseStateDone:
+		return "Done"
+	default:
+		return "Unknown"
+	}
+}
+
+// ResponseFromReader parses a response to a GET style request
+func ResponseFromReader(reader io.Reader) (*Response, error) {
+	return ResponseFromReaderForMethod(reader, "GET")
+}
+
+// ResponseFromReaderForMethod parses a response to a request with the given
+// method. Responses to HEAD never have a body.
+func ResponseFromReaderForMethod(reader io.Reader, method string) (*Response, error) {
+	buf := make([]byte, readBufferSize)
+
+	readToIndex := 0
+
+	newResponse := Response{
+		parserState:   ResponseStateParsingStatusLine,
+		Headers:       headers.NewHeaders(),
+		Trailers:      headers.NewHeaders(),
+		requestMethod: method,
+	}
+
+	for newResponse.parserState != ResponseStateDone {
+		if readToIndex >= len(buf) {
+			newBuf := make([]byte, len(buf)*2)
+			copy(newBuf, buf)
+			buf = newBuf
+		}
+
+		bytesRead, readErr := reader.Read(buf[readToIndex:])
+		readToIndex += bytesRead
+
+		bytesParsed, err := newResponse.parse(buf[:readToIndex])
+		if err != nil {
+			return nil, err
+		}
+
+		copy(buf, buf[bytesParsed:])
+		readToIndex -= bytesParsed
+
+		if readErr != nil {
+			if errors.Is(readErr, io.EOF) {
+				// Without framing the body runs until the connection closes
+				if newResponse.closeDelimited && newResponse.parserState == ResponseStateParsingBody {
+					newResponse.parserState = ResponseStateDone
+					break
+				}
+
+				if newResponse.parserState != ResponseStateDone {
+					return nil, fmt.Errorf("Incomplete Response")
+				}
+				break
+			}
+			return nil, readErr
+		}
+	}
+
+	if readToIndex > 0 {
+		newResponse.leftover = append([]byte(nil), buf[:readToIndex]...)
+	}
+
+	return &newResponse, nil
+}
+
+// Leftover returns bytes that were read from the reader after the end of the
+// response, such as the start of the next response on a kept alive
+// connection. Reading continues from them before the reader.
+func (r *Response) Leftover() []byte {
+	return r.leftover
+}
+
+func parseStatusLine(data []byte) (*StatusLine, int, error) {
+	idx := bytes.Index(data, []byte("\r\n"))
+
+	if idx == -1 {
+		return nil, 0, nil
+	}
+
+	statusLine, err := statusLineFromString(string(data[:idx]))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return statusLine, idx + 2, nil
+}
+
+func statusLineFromString(line string) (*StatusLine, error) {
+	// The reason phrase may contain spaces or be missing entirely
+	statusSplit := strings.SplitN(line, " ", 3)
+	if len(statusSplit) < 2 {
+		return nil, fmt.Errorf("Invalid status line: %s", line)
+	}
+
+	httpVersion := strings.Split(statusSplit[0], "/")
+	if len(httpVersion) != 2 || httpVersion[0] != "HTTP" {
+		return nil, fmt.Errorf("Http Version is incorrect %s", statusSplit[0])
+	}
+	if httpVersion[1] != "1.1" && httpVersion[1] != "1.0" {
+		return nil, fmt.Errorf("Http Version is incorrect %s", httpVersion[1])
+	}
+
+	if len(statusSplit[1]) != 3 {
+		return nil, fmt.Errorf("Invalid status code: %s", statusSplit[1])
+	}
+	statusCode, err := strconv.Atoi(statusSplit[1])
+	if err != nil || statusCode < 100 {
+		return nil, fmt.Errorf("Invalid status code: %s", statusSplit[1])
+	}
+
+	reasonPhrase := ""
+	if len(statusSplit) == 3 {
+		reasonPhrase = statusSplit[2]
+	}
+
+	return &StatusLine{
+		HttpVersion:  httpVersion[1],
+		StatusCode:   StatusCode(statusCode),
+		ReasonPhrase: reasonPhrase,
+	}, nil
+}
+
+func (r *Response) parse(data []byte) (int, error) {
+	totalBytesParsed := 0
+
+	for r.parserState != ResponseStateDone {
+		n, err := r.parseSingle(data[totalBytesParsed:])
+		if err != nil {
+			return 0, fmt.Errorf("Error: %v", err)
+		}
+		if n == 0 {
+			break
+		}
+
+		totalBytesParsed += n
+	}
+
+	return totalBytesParsed, nil
+}
+
+func (r *Response) parseSingle(data []byte) (int, error) {
+	switch r.parserState {
+	case ResponseStateParsingStatusLine:
+		statusLine, bytesRead, err := parseStatusLine(data)
+		if err != nil {
+			return 0, err
+		}
+
+		if bytesRead == 0 {
+			return 0, nil
+		}
+
+		r.StatusLine = *statusLine
+		r.parserState = ResponseStateParsingHeaders
+		return bytesRead, nil
+
+	case ResponseStateParsingHeaders:
+		bytesParsed, done, err := r.Headers.Parse(data)
+		if err != nil {
+			return 0, err
+		}
+
+		if done {
+			if r.isInformational() {
+				// The final response follows on the same connection
+				r.Informational = append(r.Informational, InformationalResponse{r.StatusLine, r.Headers})
+				r.Headers = headers.NewHeaders()
+				r.parserState = ResponseStateParsingStatusLine
+				return 2, nil
+			}
+
+			if err := r.startBody(); err != nil {
+				return 0, err
+			}
+			return 2, nil
+		}
+
+		return bytesParsed, nil
+
+	case ResponseStateParsingBody:
+		if r.closeDelimited {
+			r.Body = append(r.Body, data...)
+			return len(data), nil
+		}
+
+		n := min(int64(len(data)), r.bodyRemaining)
+		r.Body = append(r.Body, data[:n]...)
+		r.bodyRemaining -= n
+		if r.bodyRemaining == 0 {
+			r.parserState = ResponseStateDone
+		}
+		return int(n), nil
+
+	case ResponseStateParsingChunkSize:
+		idx := bytes.Index(data, []byte("\r\n"))
+		if idx == -1 {
+			return 0, nil
+		}
+
+		// Chunk extensions after ; are ignored
+		sizeField, _, _ := strings.Cut(string(data[:idx]), ";")
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeField), 16, 64)
+		if err != nil || size < 0 {
+			return 0, fmt.Errorf("Invalid chunk size: %s", string(data[:idx]))
+		}
+
+		if size == 0 {
+			r.parserState = ResponseStateParsingTrailers
+		} else {
+			r.bodyRemaining = size
+			r.parserState = ResponseStateParsingChunkData
+		}
+		return idx + 2, nil
+
+	case ResponseStateParsingChunkData:
+		n := min(int64(len(data)), r.bodyRemaining)
+		r.Body = append(r.Body, data[:n]...)
+		r.bodyRemaining -= n
+		if r.bodyRemaining == 0 {
+			r.parserState = ResponseStateParsingChunkEnd
+		}
+		return int(n), nil
+
+	case ResponseStateParsingChunkEnd:
+		if len(data) < 2 {
+			return 0, nil
+		}
+
+		if !bytes.HasPrefix(data, []byte("\r\n")) {
+			return 0, fmt.Errorf("Missing CRLF after chunk data")
+		}
+
+		r.parserState = ResponseStateParsingChunkSize
+		return 2, nil
+
+	case ResponseStateParsingTrailers:
+		bytesParsed, done, err := r.Trailers.Parse(data)
+		if err != nil {
+			return 0, err
+		}
+
+		if done {
+			r.parserState = ResponseStateDone
+			return 2, nil
+		}
+
+		return bytesParsed, nil
+
+	case ResponseStateDone:
+		return 0, fmt.Errorf("Attempting read data in done state")
+
+	default:
+		return 0, fmt.Errorf("Unknown State")
+	}
+}
+
+// startBody picks how the body is framed once the headers are complete
+func (r *Response) startBody() error {
+	if !r.hasBody() {
+		r.parserState = ResponseStateDone
+		return nil
+	}
+
+	if transferEncoding := r.Get("Transfer-Encoding"); transferEncoding != "" {
+		if !strings.HasSuffix(strings.ToLower(strings.TrimSpace(transferEncoding)), "chunked") {
+			// Any other final coding is delimited by closing the connection
+			r.closeDelimited = true
+			r.parserState = ResponseStateParsingBody
+			return nil
+		}
+
+		r.parserState = ResponseStateParsingChunkSize
+		return nil
+	}
+
+	if contentLength := r.Get("Content-Length"); contentLength != "" {
+		n, err := strconv.ParseInt(contentLength, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("Invalid content-length: %s", contentLength)
+		}
+
+		if n == 0 {
+			r.parserState = ResponseStateDone
+			return nil
+		}
+
+		r.bodyRemaining = n
+		r.parserState = ResponseStateParsingBody
+		return nil
+	}
+
+	r.closeDelimited = true
+	r.parserState = ResponseStateParsingBody
+	return nil
+}
+
+// isInformational reports whether the response just parsed is an interim
+// one. 101 ends the HTTP exchange so it counts as final.
+func (r *Response) isInformational() bool {
+	code := r.StatusLine.StatusCode
+	return code >= 100 && code <= 199 && code != StatusSwitchingProtocols
+}
+
+func (r *Response) hasBody() bool {
+	return bodyAllowed(r.StatusLine.StatusCode) && r.requestMethod != "HEAD"
+}
+
+func (r *Response) Get(key string) string {
+	return r.Headers.Get(key)
+}
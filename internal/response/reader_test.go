@@ -0,0 +1,180 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatusLineParse(t *testing.T) {
+	// Test: Good status line
+	reader := &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "1.1", r.StatusLine.HttpVersion)
+	assert.Equal(t, StatusOk, r.StatusLine.StatusCode)
+	assert.Equal(t, "OK", r.StatusLine.ReasonPhrase)
+
+	// Test: Reason phrase with spaces
+	reader = &chunkReader{
+		data:            "HTTP/1.1 500 Internal Server Error\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCode(500), r.StatusLine.StatusCode)
+	assert.Equal(t, "Internal Server Error", r.StatusLine.ReasonPhrase)
+
+	// Test: Invalid status code
+	reader = &chunkReader{
+		data:            "HTTP/1.1 2000 OK\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Invalid version
+	reader = &chunkReader{
+		data:            "TCP/1.1 200 OK\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Header line without a colon
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nBogus\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	require.Error(t, err)
+}
+
+func TestResponseBodyParse(t *testing.T) {
+	// Test: Content-Length body
+	reader := &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n" +
+			"hello world!\n",
+		numBytesPerRead: 3,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", string(r.Body))
+
+	// Test: Body shorter than content length
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Content-Length: 20\r\n" +
+			"\r\n" +
+			"partial content",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Chunked body with trailers
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Content-Length\r\n" +
+			"\r\n" +
+			"6\r\nhello \r\n" +
+			"6;ext=1\r\nworld!\r\n" +
+			"0\r\n" +
+			"X-Content-Length: 12\r\n" +
+			"\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!", string(r.Body))
+	assert.Equal(t, "12", r.Trailers.Get("X-Content-Length"))
+
+	// Test: Invalid chunk size
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"\r\n" +
+			"zz\r\nhello\r\n",
+		numBytesPerRead: 4,
+	}
+	_, err = ResponseFromReader(reader)
+	require.Error(t, err)
+
+	// Test: Close delimited body
+	reader = &chunkReader{
+		data: "HTTP/1.0 200 OK\r\n" +
+			"\r\n" +
+			"until the connection closes",
+		numBytesPerRead: 5,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "until the connection closes", string(r.Body))
+
+	// Test: 304 has no body despite content-length
+	reader = &chunkReader{
+		data: "HTTP/1.1 304 Not Modified\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Empty(t, r.Body)
+
+	// Test: Response to HEAD has no body
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Content-Length: 13\r\n" +
+			"\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = ResponseFromReaderForMethod(reader, "HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "13", r.Get("Content-Length"))
+	assert.Empty(t, r.Body)
+
+	// Test: Bytes read past the response are kept for the next one
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\nContent-Length: 5\r\n\r\nfirst" +
+			"HTTP/1.1 200 OK\r\nContent-Length: 6\r\n\r\nsecond",
+		numBytesPerRead: 64,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "first", string(r.Body))
+	require.NotEmpty(t, r.Leftover())
+	r, err = ResponseFromReader(io.MultiReader(bytes.NewReader(r.Leftover()), reader))
+	require.NoError(t, err)
+	assert.Equal(t, "second", string(r.Body))
+	assert.Empty(t, r.Leftover())
+}
+
+type chunkReader struct {
+	data            string
+	numBytesPerRead int
+	pos             int
+}
+
+func (cr *chunkReader) Read(p []byte) (n int, err error) {
+	if cr.pos >= len(cr.data) {
+		return 0, io.EOF
+	}
+	endIndex := cr.pos + cr.numBytesPerRead
+	if endIndex > len(cr.data) {
+		endIndex = len(cr.data)
+	}
+	n = copy(p, cr.data[cr.pos:endIndex])
+	cr.pos += n
+	return n, nil
+}
@@ -0,0 +1,115 @@
+package response
+
+import (
+	"io"
+	"sync"
+)
+
+const copyBufferSize = 32 * 1024
+
+var copyBufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, copyBufferSize)
+		return &buf
+	},
+}
+
+// ReadFrom copies r into the body, which makes io.Copy and ServeContent
+// stream through it. When the content-length is declared and the body is
+// sent unchanged, r is handed to W's own ReadFrom so a *net.TCPConn can send
+// an *os.File with sendfile or splice instead of copying through user space.
+// Otherwise r is copied in bounded chunks through Write. Bodies that are
+// suppressed, for HEAD, are not read at all once their length is declared.
+func (writer *Writer) ReadFrom(r io.Reader) (int64, error) {
+	if writer.writerState < WritingBody && writer.Header().Get("content-length") != "" {
+		if err := writer.writeImplicitHeaders(true); err != nil {
+			return 0, err
+		}
+	}
+
+	// None of a HEAD response's body is sent, with its length declared
+	// there is no need to read it either
+	if writer.writerState == WritingBody && writer.noBody() && writer.contentLength >= 0 {
+		return writer.skipBody(r), nil
+	}
+
+	if rf, ok := writer.zeroCopyTarget(); ok {
+		// Headers still sitting in a bufio.Writer would stop it passing r
+		// straight through to the connection
+		if f, ok := writer.W.(Flusher); ok {
+			if err := f.Flush(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := rf.ReadFrom(limitBody(r, writer.contentLength-writer.bodyWritten))
+		writer.countBody(n)
+		return n, err
+	}
+
+	bufp := copyBufferPool.Get().(*[]byte)
+	defer copyBufferPool.Put(bufp)
+	buf := *bufp
+
+	var total int64
+	for {
+		nr, readErr := r.Read(buf)
+		if nr > 0 {
+			nw, err := writer.Write(buf[:nr])
+			total += int64(nw)
+			if err != nil {
+				return total, err
+			}
+		}
+
+		if readErr == io.EOF {
+			return total, nil
+		}
+		if readErr != nil {
+			return total, readErr
+		}
+	}
+}
+
+// zeroCopyTarget returns W as an io.ReaderFrom when body bytes can go to it
+// untouched and their number is bounded by a declared content-length
+func (writer *Writer) zeroCopyTarget() (io.ReaderFrom, bool) {
+	if writer.writerState != WritingBody || writer.chunked || writer.compressor != nil || writer.noBody() {
+		return nil, false
+	}
+
+	if writer.contentLength < 0 {
+		return nil, false
+	}
+
+	rf, ok := writer.W.(io.ReaderFrom)
+	return rf, ok
+}
+
+// skipBody accounts for the rest of a declared body without reading r. An
+// *io.LimitedReader, which io.CopyN passes, is advanced so the caller sees
+// its bytes as consumed.
+func (writer *Writer) skipBody(r io.Reader) int64 {
+	n := writer.contentLength - writer.bodyWritten
+	if lr, ok := r.(*io.LimitedReader); ok {
+		n = min(n, lr.N)
+		lr.N -= n
+	}
+
+	writer.countBody(n)
+	return n
+}
+
+// limitBody caps r at the bytes left of the content-length. An existing
+// *io.LimitedReader is not wrapped again since the sendfile path only looks
+// through one.
+func limitBody(r io.Reader, remaining int64) io.Reader {
+	if lr, ok := r.(*io.LimitedReader); ok {
+		if lr.N <= remaining {
+			return lr
+		}
+		return &io.LimitedReader{R: lr.R, N: remaining}
+	}
+
+	return io.LimitReader(r, remaining)
+}
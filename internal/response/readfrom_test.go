@@ -0,0 +1,73 @@
+package response
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterReadFrom(t *testing.T) {
+	// Test: Declared length goes straight to the destination
+	buf := &bytes.Buffer{}
+	w := &Writer{W: buf}
+	w.Header().Set("content-length", "5")
+	n, err := w.ReadFrom(strings.NewReader("hello world"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "content-length: 5\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello"))
+
+	// Test: Unknown length is copied through Write
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf, BufferSize: 4}
+	n, err = w.ReadFrom(strings.NewReader("hello world"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), n)
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "transfer-encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "b\r\nhello world\r\n0\r\n\r\n"))
+
+	// Test: File sent over a TCP connection
+	content := strings.Repeat("0123456789", 10000)
+	path := filepath.Join(t.TempDir(), "body.txt")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	received := make(chan string)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			received <- ""
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	w = &Writer{W: conn}
+	require.NoError(t, ServeContent(w, rangeRequest("", ""), file))
+	require.NoError(t, w.Close())
+	require.NoError(t, conn.Close())
+
+	data := <-received
+	assert.Contains(t, data, "content-length: 100000\r\n")
+	assert.True(t, strings.HasSuffix(data, "\r\n\r\n"+content))
+}
@@ -4,16 +4,43 @@ import (
 	"fmt"
 	"io"
 	"maps"
+	"strconv"
+	"strings"
 	"github.com/TJ-R/httpfromtcp/internal/headers"
 )
 
 type StatusCode int 
 type WriterState int
 
+// Flusher is implemented by response writers that can push buffered output
+// to the client before the handler returns.
+type Flusher interface {
+	Flush() error
+}
+
 const (
 	StatusOk StatusCode = 200
 	StatusClientError   = 400
 	StatusServerError   = 500
+
+	StatusContinue             StatusCode = 100
+	StatusSwitchingProtocols   StatusCode = 101
+	StatusProcessing           StatusCode = 102
+	StatusEarlyHints           StatusCode = 103
+	StatusNoContent            StatusCode = 204
+	StatusPartialContent       StatusCode = 206
+	StatusNotModified          StatusCode = 304
+	StatusForbidden            StatusCode = 403
+	StatusNotFound             StatusCode = 404
+	StatusMethodNotAllowed     StatusCode = 405
+	StatusNotAcceptable        StatusCode = 406
+	StatusPreconditionFailed   StatusCode = 412
+	StatusRangeNotSatisfiable  StatusCode = 416
+	StatusUpgradeRequired      StatusCode = 426
+	StatusRequestHeaderFieldsTooLarge StatusCode = 431
+	StatusNotImplemented       StatusCode = 501
+	StatusBadGateway           StatusCode = 502
+	StatusServiceUnavailable   StatusCode = 503
 )
 
 const (
@@ -21,8 +48,11 @@ const (
 	WritingHeaders
 	WritingBody
 	WritingTrailers
+	WritingDone
 )
 
+const DefaultBufferSize = 4096
+
 
 type Writer struct {
 	W io. Writer
@@ -31,6 +61,48 @@ type Writer struct {
 	Headers    headers.Headers
 	Body       []byte
 	Trailers   headers.Headers
+
+	// BufferSize bounds how much Write output is held back to compute
+	// content-length before switching to chunked encoding
+	BufferSize int
+	buf        []byte
+
+	// Framing declared by WriteHeaders. contentLength is -1 when the
+	// headers did not include a content-length.
+	chunked       bool
+	contentLength int64
+	bodyWritten   int64
+
+	// AcceptsTrailers is set when the client sent TE: trailers. With
+	// DropTrailersWithoutTE trailer fields are omitted for other clients.
+	AcceptsTrailers       bool
+	DropTrailersWithoutTE bool
+	declaredTrailers      []string
+
+	// Set up by EnableCompression. Bodies with a known length below
+	// CompressionMinSize are sent as is.
+	CompressionMinSize  int
+	compressionEnabled  bool
+	acceptEncoding      string
+	compressor          compressWriter
+
+	// SuppressBody is set for HEAD requests. Headers are produced as they
+	// would be for GET but no body bytes reach W.
+	SuppressBody    bool
+	suppressedBytes int64
+
+	// ServerToken is sent in the server header, DefaultServerToken if empty
+	ServerToken string
+
+	// KeepAlive is set by the server when the connection can carry another
+	// request. Without it responses are sent with connection: close.
+	KeepAlive bool
+
+	hijack   HijackFunc
+	hijacked bool
+
+	observers  []Observer
+	closeHooks []func()
 }
 
 func (writer *Writer) GetStatusLine() {
@@ -38,19 +110,13 @@ func (writer *Writer) GetStatusLine() {
 }
 
 func (writer *Writer) WriteStatusLine(statusCode StatusCode) error {
+	if writer.writerState != WritingStatus {
+		return fmt.Errorf("StatusLine has already been written")
+	}
+
 	writer.StatusCode = statusCode
 
-	statusReason := ""
-	switch statusCode {
-	case StatusOk:
-		statusReason = "OK"
-	case StatusClientError:
-		statusReason = "Bad Request"
-	case StatusServerError:
-		statusReason = "Internal Server Error"
-	default:
-		statusReason = "Unknown Status Code"
-	}
+	statusReason := StatusText(statusCode)
 
 	_, err := writer.W.Write([]byte(fmt.Sprintf("HTTP/1.1 %d %s\r\n", writer.StatusCode, statusReason)))
 	if err != nil {
@@ -62,14 +128,96 @@ func (writer *Writer) WriteStatusLine(statusCode StatusCode) error {
 	return nil
 }
 
+func StatusText(statusCode StatusCode) string {
+	switch statusCode {
+	case StatusContinue:
+		return "Continue"
+	case StatusSwitchingProtocols:
+		return "Switching Protocols"
+	case StatusProcessing:
+		return "Processing"
+	case StatusEarlyHints:
+		return "Early Hints"
+	case StatusOk:
+		return "OK"
+	case StatusNoContent:
+		return "No Content"
+	case StatusPartialContent:
+		return "Partial Content"
+	case StatusNotModified:
+		return "Not Modified"
+	case StatusClientError:
+		return "Bad Request"
+	case StatusForbidden:
+		return "Forbidden"
+	case StatusNotFound:
+		return "Not Found"
+	case StatusMethodNotAllowed:
+		return "Method Not Allowed"
+	case StatusNotAcceptable:
+		return "Not Acceptable"
+	case StatusPreconditionFailed:
+		return "Precondition Failed"
+	case StatusRangeNotSatisfiable:
+		return "Range Not Satisfiable"
+	case StatusUpgradeRequired:
+		return "Upgrade Required"
+	case StatusRequestHeaderFieldsTooLarge:
+		return "Request Header Fields Too Large"
+	case StatusServerError:
+		return "Internal Server Error"
+	case StatusNotImplemented:
+		return "Not Implemented"
+	case StatusBadGateway:
+		return "Bad Gateway"
+	case StatusServiceUnavailable:
+		return "Service Unavailable"
+	default:
+		return "Unknown Status Code"
+	}
+}
+
 func (writer *Writer) WriteHeaders(newHeaders headers.Headers) error {
 	if writer.writerState != WritingHeaders {
 		return fmt.Errorf("Writing Headers before StatusLine")
 	}
 
+	chunked := strings.Contains(strings.ToLower(newHeaders.Get("transfer-encoding")), "chunked")
+	contentLength := int64(-1)
+	if value := newHeaders.Get("content-length"); value != "" {
+		if chunked {
+			return fmt.Errorf("Cannot declare both content-length and chunked transfer-encoding")
+		}
+
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("Invalid content-length: %s", value)
+		}
+		contentLength = n
+	}
+
+	if err := writer.DeclareTrailers(strings.Split(newHeaders.Get("trailer"), ",")...); err != nil {
+		return err
+	}
+
 	writer.Headers = headers.NewHeaders() 
 
 	maps.Copy(writer.Headers, newHeaders)
+
+	writer.addDateAndServer(writer.Headers)
+
+	writer.chunked = chunked
+	writer.contentLength = contentLength
+	if !bodyAllowed(writer.StatusCode) {
+		// A 304 may carry the content-length of the full representation
+		writer.contentLength = -1
+	}
+	writer.setupCompression()
+
+	writer.Headers.Delete("trailer")
+	if (chunked || writer.compressor != nil) && len(writer.declaredTrailers) > 0 && writer.sendTrailers() {
+		writer.Headers.Set("trailer", strings.Join(writer.declaredTrailers, ", "))
+	}
 	
 	for k, v := range writer.Headers {
 		_, err := writer.W.Write([]byte(k + ": " + v + "\r\n"))
@@ -84,6 +232,9 @@ func (writer *Writer) WriteHeaders(newHeaders headers.Headers) error {
 	}
 
 	writer.writerState = WritingBody
+	for _, o := range writer.observers {
+		o.WroteHeaders(writer.StatusCode, writer.Headers)
+	}
 	return nil
 }
 
@@ -92,7 +243,22 @@ func (writer *Writer) WriteBody(p []byte) error {
 		return fmt.Errorf("Writing Body before Headers")
 	}
 
-	_, err := writer.W.Write(p)
+	if writer.chunked {
+		return fmt.Errorf("Writing unchunked Body after declaring chunked transfer-encoding")
+	}
+
+	if writer.contentLength >= 0 && writer.bodyWritten+int64(len(p)) > writer.contentLength {
+		return fmt.Errorf("Body exceeds content-length of %d bytes", writer.contentLength)
+	}
+
+	if writer.compressor != nil {
+		n, err := writer.compressor.Write(p)
+		writer.countBody(int64(n))
+		return err
+	}
+
+	n, err := writer.bodyOut().Write(p)
+	writer.countBody(int64(n))
 	if err != nil {
 		return err
 	}
@@ -105,37 +271,76 @@ func (writer *Writer) WriteChunkedBody(p []byte) (int, error) {
 		return 0, fmt.Errorf("Writing Body before Headers")
 	}
 
+	if !writer.chunked {
+		return 0, fmt.Errorf("Writing chunked Body without declaring chunked transfer-encoding")
+	}
+
+	if writer.compressor != nil {
+		n, err := writer.compressor.Write(p)
+		writer.countBody(int64(n))
+		return n, err
+	}
+
+	n, err := writeChunk(writer.bodyOut(), p)
+	if err != nil {
+		return 0, err
+	}
+	writer.countBody(int64(len(p)))
+
+	return n, nil
+}
+
+func writeChunk(w io.Writer, p []byte) (int, error) {
+	// A zero length chunk would terminate the body early
+	if len(p) == 0 {
+		return 0, nil
+	}
+
 	totalBytes := 0
-	n, err := writer.W.Write([]byte(fmt.Sprintf("%x\r\n", len(p))))
+	n, err := w.Write([]byte(fmt.Sprintf("%x\r\n", len(p))))
 	totalBytes += n
 	if err != nil {
-		return 0, err
+		return totalBytes, err
 	}
 
-	n, err = writer.W.Write(p)
+	n, err = w.Write(p)
 	totalBytes += n
 	if err != nil {
-		return 0, err
+		return totalBytes, err
 	}
 
-	n, err = writer.W.Write([]byte("\r\n"))
+	n, err = w.Write([]byte("\r\n"))
 	totalBytes += n
 	if err != nil {
-		return 0, err
+		return totalBytes, err
 	}
 
 	return totalBytes, nil
 }
 
 func (writer *Writer) WriteChunkedBodyDone() (int, error) {
-	_, err := writer.W.Write([]byte("0\r\n"))
+	if writer.writerState != WritingBody {
+		return 0, fmt.Errorf("Incorrect order for response write")
+	}
+
+	if !writer.chunked {
+		return 0, fmt.Errorf("Ending chunked Body without declaring chunked transfer-encoding")
+	}
+
+	if writer.compressor != nil {
+		if err := writer.compressor.Close(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := writer.bodyOut().Write([]byte("0\r\n"))
 	if err != nil {
-		return 0, err
+		return n, err
 	}
 
 	writer.writerState = WritingTrailers
 
-	return 0, nil
+	return n, nil
 }
 
 func (writer *Writer) WriteTrailers(trailers headers.Headers)  error {
@@ -143,24 +348,266 @@ func (writer *Writer) WriteTrailers(trailers headers.Headers)  error {
 		return fmt.Errorf("Incorrect order for response write")
 	}
 
+	if !writer.chunked {
+		return fmt.Errorf("Writing Trailers without declaring chunked transfer-encoding")
+	}
+
+	for k := range trailers {
+		if err := writer.checkTrailer(k); err != nil {
+			return err
+		}
+	}
+
 	writer.Trailers = headers.NewHeaders() 
 
-	maps.Copy(writer.Trailers, trailers)
+	if writer.sendTrailers() {
+		maps.Copy(writer.Trailers, trailers)
+	}
 	
+	// Names go out lowercased like the trailer header that declared them
 	for k, v := range writer.Trailers {
-		_, err := writer.W.Write([]byte(k + ": " + v + "\r\n"))
+		_, err := writer.bodyOut().Write([]byte(strings.ToLower(k) + ": " + v + "\r\n"))
 		if err != nil {
 			return err
 		}
 	}
 	
-	_, err := writer.W.Write([]byte("\r\n")) 
+	_, err := writer.bodyOut().Write([]byte("\r\n")) 
 	if err != nil {
 		return err
 	}
 
+	writer.writerState = WritingDone
+	return nil
+
+}
+
+// Header returns the headers that will be sent with the implicit status
+// line on the first Write. Changes made after that have no effect.
+func (writer *Writer) Header() headers.Headers {
+	if writer.Headers == nil {
+		writer.Headers = headers.NewHeaders()
+	}
+
+	return writer.Headers
+}
+
+// SetStatus sets the status code sent implicitly by Write and Close.
+// Defaults to StatusOk.
+func (writer *Writer) SetStatus(statusCode StatusCode) {
+	writer.StatusCode = statusCode
+}
+
+func (writer *Writer) Write(p []byte) (int, error) {
+	switch writer.writerState {
+	case WritingStatus, WritingHeaders:
+		// Nothing will be sent so only the length is kept for content-length
+		if writer.noBody() {
+			writer.suppressedBytes += int64(len(p))
+			return len(p), nil
+		}
+
+		if len(writer.buf)+len(p) <= writer.bufferSize() {
+			writer.buf = append(writer.buf, p...)
+			return len(p), nil
+		}
+
+		if err := writer.writeImplicitHeaders(true); err != nil {
+			return 0, err
+		}
+	case WritingBody:
+	default:
+		return 0, fmt.Errorf("Writing Body after Body is complete")
+	}
+
+	if writer.chunked {
+		if _, err := writer.WriteChunkedBody(p); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+
+	if err := writer.WriteBody(p); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close finishes the response, sending the status line, headers and any
+// buffered body the handler has not written yet.
+func (writer *Writer) Close() error {
+	hooks := writer.closeHooks
+	writer.closeHooks = nil
+	for _, f := range hooks {
+		f()
+	}
+
+	switch writer.writerState {
+	case WritingStatus, WritingHeaders:
+		if err := writer.writeImplicitHeaders(false); err != nil {
+			return err
+		}
+		return writer.Close()
+	case WritingBody:
+		if !writer.chunked {
+			if writer.contentLength >= 0 && writer.bodyWritten < writer.contentLength {
+				writer.writerState = WritingDone
+				return fmt.Errorf("Body shorter than content-length: wrote %d of %d bytes", writer.bodyWritten, writer.contentLength)
+			}
+
+			if writer.compressor != nil {
+				return writer.finishCompression()
+			}
+			writer.writerState = WritingDone
+			return nil
+		}
+
+		if _, err := writer.WriteChunkedBodyDone(); err != nil {
+			return err
+		}
+		return writer.WriteTrailers(writer.Trailers)
+	case WritingTrailers:
+		return writer.WriteTrailers(writer.Trailers)
+	}
+
 	return nil
+}
+
+// Written reports whether any of the final response has been written to
+// W. Until then the handler's output can still be replaced entirely.
+func (writer *Writer) Written() bool {
+	return writer.writerState != WritingStatus
+}
+
+// Reset drops the status, headers, trailers and buffered body set so far
+// so that a different response can be written instead. Settings such as
+// compression from EnableCompression are kept. It fails once Written.
+func (writer *Writer) Reset() error {
+	if writer.Written() {
+		return fmt.Errorf("Resetting a response that has been written")
+	}
+
+	writer.StatusCode = 0
+	writer.Headers = nil
+	writer.Trailers = nil
+	writer.declaredTrailers = nil
+	writer.buf = nil
+	writer.suppressedBytes = 0
+	return nil
+}
+
+// Flush sends any buffered output to the client. If nothing has been sent
+// yet the headers are committed with chunked encoding since the final
+// length is not known.
+func (writer *Writer) Flush() error {
+	switch writer.writerState {
+	case WritingStatus, WritingHeaders:
+		if err := writer.writeImplicitHeaders(true); err != nil {
+			return err
+		}
+	}
+
+	if writer.compressor != nil && writer.writerState == WritingBody {
+		if err := writer.compressor.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if f, ok := writer.W.(Flusher); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
+
+func (writer *Writer) writeImplicitHeaders(chunked bool) error {
+	if writer.writerState == WritingStatus {
+		statusCode := writer.StatusCode
+		if statusCode == 0 {
+			statusCode = StatusOk
+		}
+
+		if err := writer.WriteStatusLine(statusCode); err != nil {
+			return err
+		}
+	}
+
+	h := writer.Header()
+	if h.Get("trailer") != "" || len(writer.declaredTrailers) > 0 {
+		// Trailers can only follow a chunked body
+		chunked = true
+		h.Delete("content-length")
+	}
+
+	// Statuses without a body get no framing or content-type
+	if bodyAllowed(writer.StatusCode) {
+		// A content-length set by the handler is kept even when the body
+		// outgrows the buffer
+		if chunked && h.Get("content-length") == "" {
+			h.Set("transfer-encoding", "chunked")
+		} else if h.Get("content-length") == "" && h.Get("transfer-encoding") == "" {
+			h.Set("content-length", fmt.Sprintf("%d", int64(len(writer.buf))+writer.suppressedBytes))
+		}
+
+		if h.Get("content-type") == "" {
+			h.Set("content-type", "text/plain")
+		}
+	}
+
+	if h.Get("connection") == "" && !writer.KeepAlive {
+		h.Set("connection", "close")
+	}
+
+	if err := writer.WriteHeaders(h); err != nil {
+		return err
+	}
+	writer.countBody(writer.suppressedBytes)
+
+	buf := writer.buf
+	writer.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+
+	if writer.chunked {
+		_, err := writer.WriteChunkedBody(buf)
+		return err
+	}
+
+	return writer.WriteBody(buf)
+}
+
+// bodyOut is where everything after the header block is written
+func (writer *Writer) bodyOut() io.Writer {
+	if writer.noBody() {
+		return io.Discard
+	}
+
+	return writer.W
+}
+
+// noBody reports whether body bytes are dropped, either for a HEAD request
+// or because the status never carries a body
+func (writer *Writer) noBody() bool {
+	statusCode := writer.StatusCode
+	if statusCode == 0 {
+		statusCode = StatusOk
+	}
+
+	return writer.SuppressBody || !bodyAllowed(statusCode)
+}
+
+func bodyAllowed(statusCode StatusCode) bool {
+	return statusCode >= 200 && statusCode != StatusNoContent && statusCode != StatusNotModified
+}
+
+func (writer *Writer) bufferSize() int {
+	if writer.BufferSize > 0 {
+		return writer.BufferSize
+	}
 
+	return DefaultBufferSize
 }
 
 func GetDefaultHeaders(contentLen int) headers.Headers {
@@ -0,0 +1,174 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterImplicit(t *testing.T) {
+	// Test: Small body is buffered and sent with content-length
+	buf := &bytes.Buffer{}
+	w := &Writer{W: buf}
+	w.Header().Set("Content-Type", "text/html")
+	n, err := w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	assert.Equal(t, 11, n)
+	assert.Equal(t, 0, buf.Len())
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 200 OK\r\n"))
+	assert.Contains(t, buf.String(), "content-length: 11\r\n")
+	assert.Contains(t, buf.String(), "content-type: text/html\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\nhello world"))
+
+	// Test: Status set before the first write
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf}
+	w.SetStatus(StatusClientError)
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 400 Bad Request\r\n"))
+	assert.Contains(t, buf.String(), "content-length: 0\r\n")
+
+	// Test: Body larger than the buffer switches to chunked
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf, BufferSize: 4}
+	_, err = w.Write([]byte("abc"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("defgh"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.NotContains(t, buf.String(), "content-length")
+	assert.Contains(t, buf.String(), "transfer-encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n3\r\nabc\r\n5\r\ndefgh\r\n0\r\n\r\n"))
+
+	// Test: Header changes after the first flush are ignored
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf, BufferSize: 1}
+	_, err = w.Write([]byte("ab"))
+	require.NoError(t, err)
+	w.Header().Set("X-Late", "true")
+	require.NoError(t, w.Close())
+	assert.NotContains(t, buf.String(), "x-late")
+
+	// Test: Write after the response is complete
+	_, err = w.Write([]byte("more"))
+	require.Error(t, err)
+}
+
+func TestWriterFlush(t *testing.T) {
+	// Test: Flush before any write commits chunked headers
+	buf := &bytes.Buffer{}
+	bw := bufio.NewWriter(buf)
+	w := &Writer{W: bw}
+	_, err := w.Write([]byte("partial"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, buf.Len())
+	require.NoError(t, w.Flush())
+	assert.Contains(t, buf.String(), "transfer-encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "7\r\npartial\r\n"))
+
+	// Test: Writer satisfies Flusher
+	var f Flusher = w
+	require.NoError(t, f.Flush())
+	require.NoError(t, w.Close())
+	require.NoError(t, bw.Flush())
+	assert.True(t, strings.HasSuffix(buf.String(), "0\r\n\r\n"))
+}
+
+func TestWriterStateMachine(t *testing.T) {
+	// Test: Status line written twice
+	w := &Writer{W: &bytes.Buffer{}}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.Error(t, w.WriteStatusLine(StatusOk))
+
+	// Test: Body longer than content-length
+	w = &Writer{W: &bytes.Buffer{}}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(5)))
+	require.NoError(t, w.WriteBody([]byte("abc")))
+	require.Error(t, w.WriteBody([]byte("def")))
+
+	// Test: Body shorter than content-length is reported on Close
+	require.Error(t, w.Close())
+
+	// Test: Body matching content-length
+	w = &Writer{W: &bytes.Buffer{}}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(3)))
+	require.NoError(t, w.WriteBody([]byte("abc")))
+	require.NoError(t, w.Close())
+
+	// Test: Chunks without chunked transfer-encoding
+	w = &Writer{W: &bytes.Buffer{}}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(3)))
+	_, err := w.WriteChunkedBody([]byte("abc"))
+	require.Error(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.Error(t, err)
+
+	// Test: Chunked body done before headers
+	w = &Writer{W: &bytes.Buffer{}}
+	_, err = w.WriteChunkedBodyDone()
+	require.Error(t, err)
+
+	// Test: Chunked body and trailers
+	buf := &bytes.Buffer{}
+	w = &Writer{W: buf}
+	h := GetDefaultHeaders(0)
+	h.Delete("content-length")
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(h))
+	require.Error(t, w.WriteBody([]byte("abc")))
+	_, err = w.WriteChunkedBody([]byte("abc"))
+	require.NoError(t, err)
+	_, err = w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+	require.NoError(t, w.WriteTrailers(GetDefaultTrailers()))
+	assert.True(t, strings.HasSuffix(buf.String(), "3\r\nabc\r\n0\r\n\r\n"))
+
+	// Test: Both content-length and chunked declared
+	w = &Writer{W: &bytes.Buffer{}}
+	h = GetDefaultHeaders(3)
+	h.Set("Transfer-Encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.Error(t, w.WriteHeaders(h))
+}
+
+func TestWriterSuppressBody(t *testing.T) {
+	// Test: Implicit body keeps its content-length
+	buf := &bytes.Buffer{}
+	w := &Writer{W: buf, SuppressBody: true, BufferSize: 4}
+	w.Header().Set("content-type", "video/mp4")
+	_, err := w.Write([]byte("abcdefgh"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "content-length: 8\r\n")
+	assert.Contains(t, buf.String(), "content-type: video/mp4\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+	assert.NotContains(t, buf.String(), "abcdefgh")
+
+	// Test: Explicit body is dropped
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf, SuppressBody: true}
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(GetDefaultHeaders(3)))
+	require.NoError(t, w.WriteBody([]byte("abc")))
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "content-length: 3\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "\r\n\r\n"))
+
+	// Test: Chunked body and trailers are dropped
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf, SuppressBody: true}
+	startChunked(t, w, "X-Declared")
+	require.NoError(t, w.WriteTrailers(GetDefaultTrailers()))
+	head, rest, _ := strings.Cut(buf.String(), "\r\n\r\n")
+	assert.Contains(t, head, "trailer: x-declared")
+	assert.Equal(t, "", rest)
+}
@@ -0,0 +1,198 @@
+package response
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TJ-R/httpfromtcp/internal/request"
+)
+
+// Event is a single Server-Sent Event. Empty fields are left out.
+type Event struct {
+	Event string
+	ID    string
+	Data  string
+	Retry time.Duration
+}
+
+var ErrStreamClosed = errors.New("Event stream closed")
+
+// EventStream writes text/event-stream responses. Each event is flushed to
+// the client as soon as it is sent. The underlying Writer must not be used
+// directly while the stream is open. Closing the Writer, which the server
+// does once the handler returns, closes the stream first.
+type EventStream struct {
+	w           *Writer
+	mu          sync.Mutex
+	lastEventID string
+	done        chan struct{}
+	closeOnce   sync.Once
+	stop        chan struct{}
+	stopOnce    sync.Once
+	heartbeats  sync.WaitGroup
+	err         error
+}
+
+// NewEventStream starts an event stream on w, sending the headers right
+// away so the client knows the stream is open.
+func NewEventStream(w *Writer, req *request.Request) (*EventStream, error) {
+	h := w.Header()
+	h.Set("content-type", "text/event-stream")
+	h.Set("cache-control", "no-cache")
+
+	s := &EventStream{
+		w:    w,
+		done: make(chan struct{}),
+		stop: make(chan struct{}),
+	}
+	if req != nil {
+		s.lastEventID = req.Get("Last-Event-ID")
+	}
+	w.onClose(s.Close)
+
+	if err := w.Flush(); err != nil {
+		s.fail(err)
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// LastEventID is the id the client last saw before reconnecting, taken
+// from the Last-Event-ID request header
+func (s *EventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Done is closed once a write fails, which is how a client going away is
+// noticed. Heartbeats make sure that happens even when no events are sent.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the write error that closed Done
+func (s *EventStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+func (s *EventStream) Send(event Event) error {
+	if strings.ContainsAny(event.Event, "\r\n") {
+		return fmt.Errorf("Invalid event name: %q", event.Event)
+	}
+	if strings.ContainsAny(event.ID, "\r\n\x00") {
+		return fmt.Errorf("Invalid event id: %q", event.ID)
+	}
+
+	var b strings.Builder
+	if event.Event != "" {
+		b.WriteString("event: " + event.Event + "\n")
+	}
+	if event.ID != "" {
+		b.WriteString("id: " + event.ID + "\n")
+	}
+	if event.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(event.Retry.Milliseconds(), 10) + "\n")
+	}
+
+	// Every line of the payload needs its own data field
+	data := strings.ReplaceAll(event.Data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\r", "\n")
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	return s.write(b.String())
+}
+
+// Comment sends a comment line, which clients ignore
+func (s *EventStream) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r", ""), "\n") {
+		b.WriteString(": " + line + "\n")
+	}
+	b.WriteString("\n")
+
+	return s.write(b.String())
+}
+
+// StartHeartbeat sends a comment every interval until the stream is closed
+// or the client goes away, keeping proxies from timing out the connection.
+func (s *EventStream) StartHeartbeat(interval time.Duration) {
+	s.heartbeats.Add(1)
+	go func() {
+		defer s.heartbeats.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Comment("heartbeat"); err != nil {
+					return
+				}
+			case <-s.stop:
+				return
+			case <-s.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the heartbeat and waits for it to finish, later sends fail
+// with ErrStreamClosed. The response itself is finished by the server once
+// the handler returns.
+func (s *EventStream) Close() {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	s.heartbeats.Wait()
+}
+
+func (s *EventStream) write(data string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.done:
+		return s.err
+	case <-s.stop:
+		return ErrStreamClosed
+	default:
+	}
+
+	if _, err := s.w.Write([]byte(data)); err != nil {
+		s.failLocked(err)
+		return err
+	}
+
+	if err := s.w.Flush(); err != nil {
+		s.failLocked(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *EventStream) fail(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failLocked(err)
+}
+
+func (s *EventStream) failLocked(err error) {
+	s.closeOnce.Do(func() {
+		s.err = err
+		close(s.done)
+	})
+}
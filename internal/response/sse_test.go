@@ -0,0 +1,85 @@
+package response
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEventStream(t *testing.T) {
+	// Test: Headers are sent when the stream opens
+	buf := &bytes.Buffer{}
+	w := &Writer{W: buf}
+	req := conditionalRequest("GET", "Last-Event-ID", "41")
+	s, err := NewEventStream(w, req)
+	require.NoError(t, err)
+	assert.Contains(t, buf.String(), "content-type: text/event-stream\r\n")
+	assert.Contains(t, buf.String(), "transfer-encoding: chunked\r\n")
+	assert.Equal(t, "41", s.LastEventID())
+
+	// Test: Event with every field and multi-line data
+	require.NoError(t, s.Send(Event{Event: "log", ID: "42", Data: "line one\r\nline two", Retry: 3 * time.Second}))
+	assert.Contains(t, buf.String(), "event: log\nid: 42\nretry: 3000\ndata: line one\ndata: line two\n\n")
+
+	// Test: Newlines are not allowed in the event name or id
+	require.Error(t, s.Send(Event{Event: "a\nb", Data: "x"}))
+	require.Error(t, s.Send(Event{ID: "a\nb", Data: "x"}))
+
+	// Test: Heartbeat comments
+	s.StartHeartbeat(5 * time.Millisecond)
+	assert.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return strings.Contains(buf.String(), ": heartbeat\n\n")
+	}, time.Second, 5*time.Millisecond)
+	s.Close()
+
+	// Test: Sending after Close fails
+	require.ErrorIs(t, s.Send(Event{Data: "late"}), ErrStreamClosed)
+
+	// Test: Closing the Writer stops a heartbeat that is due
+	out := &bytes.Buffer{}
+	bw := bufio.NewWriter(out)
+	w = &Writer{W: bw}
+	s, err = NewEventStream(w, nil)
+	require.NoError(t, err)
+	s.StartHeartbeat(time.Microsecond)
+	time.Sleep(5 * time.Millisecond)
+	require.NoError(t, w.Close())
+	require.NoError(t, bw.Flush())
+	finished := out.String()
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, finished, out.String())
+	assert.True(t, strings.HasSuffix(finished, "0\r\n\r\n"))
+
+	// Test: Write failure marks the client as gone
+	fw := &failingWriter{}
+	w = &Writer{W: fw}
+	s, err = NewEventStream(w, nil)
+	require.NoError(t, err)
+	fw.fail = true
+	require.Error(t, s.Send(Event{Data: "lost"}))
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("Done should be closed after a failed write")
+	}
+	require.Error(t, s.Err())
+}
+
+type failingWriter struct {
+	fail bool
+}
+
+func (fw *failingWriter) Write(p []byte) (int, error) {
+	if fw.fail {
+		return 0, errors.New("connection reset")
+	}
+	return len(p), nil
+}
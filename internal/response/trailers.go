@@ -0,0 +1,90 @@
+package response
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Fields that must not be sent as trailers because recipients rely on them
+// for framing, routing, authentication or processing the body (RFC 9110
+// section 6.5.1).
+var forbiddenTrailers = map[string]bool{
+	"transfer-encoding":   true,
+	"content-length":      true,
+	"content-encoding":    true,
+	"content-type":        true,
+	"content-range":       true,
+	"trailer":             true,
+	"host":                true,
+	"cache-control":       true,
+	"expect":              true,
+	"max-forwards":        true,
+	"pragma":              true,
+	"range":               true,
+	"te":                  true,
+	"authorization":       true,
+	"proxy-authenticate":  true,
+	"proxy-authorization": true,
+	"www-authenticate":    true,
+	"set-cookie":          true,
+}
+
+// DeclareTrailers announces the trailer fields the handler will send after
+// a chunked body. The trailer header is generated from these names when the
+// headers are written, so it must be called before then.
+func (writer *Writer) DeclareTrailers(names ...string) error {
+	if writer.writerState > WritingHeaders {
+		return fmt.Errorf("Declaring Trailers after Headers")
+	}
+
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		if forbiddenTrailers[name] {
+			return fmt.Errorf("Field not allowed as trailer: %s", name)
+		}
+
+		if !slices.Contains(writer.declaredTrailers, name) {
+			writer.declaredTrailers = append(writer.declaredTrailers, name)
+		}
+	}
+
+	return nil
+}
+
+// sendTrailers reports whether trailer fields should go on the wire. When
+// DropTrailersWithoutTE is set they are only sent to clients that asked for
+// them with TE: trailers.
+func (writer *Writer) sendTrailers() bool {
+	return !writer.DropTrailersWithoutTE || writer.AcceptsTrailers
+}
+
+func (writer *Writer) checkTrailer(name string) error {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if forbiddenTrailers[name] {
+		return fmt.Errorf("Field not allowed as trailer: %s", name)
+	}
+
+	if !slices.Contains(writer.declaredTrailers, name) {
+		return fmt.Errorf("Trailer not declared: %s", name)
+	}
+
+	return nil
+}
+
+// AcceptsTrailers reports whether a TE request header value includes the
+// trailers token.
+func AcceptsTrailers(te string) bool {
+	for _, part := range strings.Split(te, ",") {
+		token, _, _ := strings.Cut(part, ";")
+		if strings.EqualFold(strings.TrimSpace(token), "trailers") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,65 @@
+package response
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrailers(t *testing.T) {
+	// Test: Declared trailers generate the trailer header
+	buf := &bytes.Buffer{}
+	w := &Writer{W: buf}
+	require.NoError(t, w.DeclareTrailers("X-Content-SHA256", "X-Content-Length"))
+	_, err := w.Write([]byte("abc"))
+	require.NoError(t, err)
+	w.Trailers = GetDefaultTrailers()
+	w.Trailers["X-Content-Length"] = "3"
+	require.NoError(t, w.Close())
+	assert.Contains(t, buf.String(), "trailer: x-content-sha256, x-content-length\r\n")
+	assert.Contains(t, buf.String(), "transfer-encoding: chunked\r\n")
+	assert.True(t, strings.HasSuffix(buf.String(), "0\r\nx-content-length: 3\r\n\r\n"))
+
+	// Test: Undeclared trailer
+	w = &Writer{W: &bytes.Buffer{}}
+	startChunked(t, w, "X-Declared")
+	trailers := GetDefaultTrailers()
+	trailers["X-Other"] = "value"
+	require.Error(t, w.WriteTrailers(trailers))
+
+	// Test: Forbidden trailer
+	w = &Writer{W: &bytes.Buffer{}}
+	require.Error(t, w.DeclareTrailers("Content-Length"))
+	require.Error(t, w.DeclareTrailers("authorization"))
+
+	// Test: Trailers dropped when client did not send TE: trailers
+	buf = &bytes.Buffer{}
+	w = &Writer{W: buf, DropTrailersWithoutTE: true}
+	startChunked(t, w, "X-Declared")
+	trailers = GetDefaultTrailers()
+	trailers["X-Declared"] = "value"
+	require.NoError(t, w.WriteTrailers(trailers))
+	assert.NotContains(t, buf.String(), "trailer:")
+	assert.NotContains(t, buf.String(), "X-Declared: value")
+	assert.True(t, strings.HasSuffix(buf.String(), "0\r\n\r\n"))
+
+	// Test: TE header parsing
+	assert.True(t, AcceptsTrailers("trailers"))
+	assert.True(t, AcceptsTrailers("gzip;q=0.5, Trailers"))
+	assert.False(t, AcceptsTrailers("gzip"))
+	assert.False(t, AcceptsTrailers(""))
+}
+
+func startChunked(t *testing.T, w *Writer, trailers ...string) {
+	require.NoError(t, w.DeclareTrailers(trailers...))
+	h := GetDefaultHeaders(0)
+	h.Delete("content-length")
+	h.Set("transfer-encoding", "chunked")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(h))
+	_, err := w.WriteChunkedBodyDone()
+	require.NoError(t, err)
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+)
+
+// Compress wraps a handler so its responses are gzip or deflate encoded
+// when the client's Accept-Encoding allows it. Clients that rule out
+// identity and every coding offered get 406 Not Acceptable.
+func Compress(handler Handler) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		if req == nil {
+			handler(w, req)
+			return
+		}
+
+		acceptEncoding := req.Get("Accept-Encoding")
+		if encoding, identityOk := response.NegotiateEncoding(acceptEncoding); encoding == "" && !identityOk {
+			w.SetStatus(response.StatusNotAcceptable)
+			w.Header().Set("content-type", "text/plain")
+			w.Write([]byte(response.StatusText(response.StatusNotAcceptable)))
+			return
+		}
+
+		w.EnableCompression(acceptEncoding)
+		handler(w, req)
+	}
+}
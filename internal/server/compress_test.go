@@ -0,0 +1,39 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompress(t *testing.T) {
+	get := func(acceptEncoding string) *response.Response {
+		req := &request.Request{
+			RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/", HttpVersion: "1.1"},
+			Headers:     headers.NewHeaders(),
+		}
+		req.Headers.Set("Accept-Encoding", acceptEncoding)
+		buf := &bytes.Buffer{}
+		w := &response.Writer{W: buf}
+		Compress(named("ok"))(w, req)
+		require.NoError(t, w.Close())
+
+		res, err := response.ResponseFromReader(buf)
+		require.NoError(t, err)
+		return res
+	}
+
+	// Test: Identity allowed
+	res := get("br")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "ok", string(res.Body))
+
+	// Test: Nothing acceptable gets 406
+	res = get("br, identity;q=0")
+	assert.Equal(t, response.StatusNotAcceptable, res.StatusLine.StatusCode)
+}
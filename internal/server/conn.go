@@ -0,0 +1,179 @@
+package server
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ConnState is where a connection is in its lifecycle
+type ConnState int
+
+const (
+	// StateNew is a connection accepted but with no request bytes yet
+	StateNew ConnState = iota
+	// StateActive is a connection with a request being read or handled
+	StateActive
+	// StateIdle is a kept alive connection waiting for its next request
+	StateIdle
+	// StateHijacked is a connection a handler has taken over. It is
+	// dropped from the registry and the server no longer manages it.
+	StateHijacked
+	// StateClosed is a connection the server has closed
+	StateClosed
+)
+
+func (c ConnState) String() string {
+	switch c {
+	case StateNew:
+		return "new"
+	case StateActive:
+		return "active"
+	case StateIdle:
+		return "idle"
+	case StateHijacked:
+		return "hijacked"
+	case StateClosed:
+		return "closed"
+	default:
+		return "unknown"
+	}
+}
+
+// ConnInfo describes a connection in the server's registry
+type ConnInfo struct {
+	RemoteAddr net.Addr
+	State      ConnState
+	// Since is when the connection entered State
+	Since time.Time
+}
+
+// conn is a connection in the registry
+type conn struct {
+	net.Conn
+	server *Server
+
+	// Requests are read from r, the connection behind any bytes read
+	// past the previous request
+	r io.Reader
+
+	mu    sync.Mutex
+	state ConnState
+	since time.Time
+}
+
+// Read marks the connection active once the first byte of a request
+// arrives, which also ends the idle timeout
+func (c *conn) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		if c.getState() == StateIdle {
+			c.Conn.SetReadDeadline(deadline(c.server.ReadTimeout))
+		}
+		c.setState(StateActive)
+	}
+
+	return n, err
+}
+
+func (c *conn) getState() ConnState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.state
+}
+
+func (c *conn) setState(state ConnState) {
+	c.mu.Lock()
+	if c.state == state || c.state == StateHijacked || c.state == StateClosed {
+		c.mu.Unlock()
+		return
+	}
+	c.state = state
+	c.since = time.Now()
+	c.mu.Unlock()
+
+	switch state {
+	case StateHijacked, StateClosed:
+		c.server.untrackConn(c)
+	}
+
+	if hook := c.server.connStateHook(); hook != nil {
+		hook(c.Conn, state)
+	}
+}
+
+// OnConnState sets a function called every time a connection changes
+// state, from the goroutine serving it. It must not block.
+func (s *Server) OnConnState(f func(net.Conn, ConnState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connState = f
+}
+
+func (s *Server) connStateHook() func(net.Conn, ConnState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connState
+}
+
+// Connections returns a snapshot of the connections the server is
+// managing
+func (s *Server) Connections() []ConnInfo {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	infos := make([]ConnInfo, 0, len(conns))
+	for _, c := range conns {
+		c.mu.Lock()
+		infos = append(infos, ConnInfo{
+			RemoteAddr: c.RemoteAddr(),
+			State:      c.state,
+			Since:      c.since,
+		})
+		c.mu.Unlock()
+	}
+
+	return infos
+}
+
+// trackConn adds a newly accepted connection to the registry. Once the
+// server is closed the connection is closed instead and nil returned.
+func (s *Server) trackConn(rwc net.Conn) *conn {
+	c := &conn{
+		Conn:   rwc,
+		server: s,
+		r:      rwc,
+		state:  StateNew,
+		since:  time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == Closed {
+		rwc.Close()
+		return nil
+	}
+
+	if s.conns == nil {
+		s.conns = make(map[*conn]struct{})
+	}
+	s.conns[c] = struct{}{}
+
+	return c
+}
+
+func (s *Server) untrackConn(c *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, c)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnState(t *testing.T) {
+	var mu sync.Mutex
+	var states []ConnState
+	closed := make(chan struct{})
+	hijacked := make(chan net.Conn, 1)
+
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/hijack" {
+			conn, _, err := w.Hijack()
+			if err == nil {
+				hijacked <- conn
+			}
+			return
+		}
+		w.Write([]byte("ok"))
+	})
+	require.NoError(t, err)
+	defer s.Close()
+
+	s.OnConnState(func(c net.Conn, state ConnState) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		states = append(states, state)
+		if state == StateClosed || state == StateHijacked {
+			closed <- struct{}{}
+		}
+	})
+
+	// Test: Two requests on a kept alive connection
+	conn, err := net.Dial("tcp", s.Addr)
+	require.NoError(t, err)
+	for range 2 {
+		_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		res, err := response.ResponseFromReader(conn)
+		require.NoError(t, err)
+		assert.Empty(t, res.Leftover())
+	}
+
+	// Test: Registry sees the idle connection
+	require.Eventually(t, func() bool {
+		infos := s.Connections()
+		return len(infos) == 1 && infos[0].State == StateIdle
+	}, time.Second, 10*time.Millisecond)
+
+	conn.Close()
+	<-closed
+	mu.Lock()
+	assert.Equal(t, []ConnState{StateNew, StateActive, StateIdle, StateActive, StateIdle, StateClosed}, states)
+	states = nil
+	mu.Unlock()
+	assert.Empty(t, s.Connections())
+
+	// Test: Hijacked connections leave the registry and stay open
+	conn, err = net.Dial("tcp", s.Addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET /hijack HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	<-closed
+	serverSide := <-hijacked
+	defer serverSide.Close()
+
+	mu.Lock()
+	assert.Equal(t, []ConnState{StateNew, StateActive, StateHijacked}, states)
+	mu.Unlock()
+	assert.Empty(t, s.Connections())
+
+	_, err = serverSide.Write([]byte("raw"))
+	require.NoError(t, err)
+	buf := make([]byte, 3)
+	_, err = conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "raw", string(buf))
+}
+
+func TestCloseRacingAccept(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var served atomic.Int32
+	s := &Server{
+		Handler: func(w *response.Writer, req *request.Request) {
+			served.Add(1)
+		},
+	}
+	// Close lands after Accept returned but before the connection is served
+	l := &hookListener{Listener: inner, afterAccept: func() { s.Close() }}
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+
+	// Test: The connection is closed, not served after Close returned
+	conn, err := net.Dial("tcp", inner.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	assert.ErrorIs(t, <-done, ErrServerClosed)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(make([]byte, 1))
+	assert.Zero(t, n)
+	require.Error(t, err)
+	assert.False(t, errors.Is(err, os.ErrDeadlineExceeded))
+	assert.Zero(t, served.Load())
+	assert.Empty(t, s.Connections())
+}
+
+// hookListener runs afterAccept once a connection has been accepted
+type hookListener struct {
+	net.Listener
+	afterAccept func()
+}
+
+func (l *hookListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.afterAccept()
+	}
+
+	return conn, err
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"maps"
+	"sync"
+
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+)
+
+// HandlerError is an error an ErrorHandler returns to answer with
+// StatusCode. Message is shown to the client.
+type HandlerError struct {
+	StatusCode response.StatusCode
+	Message    string
+}
+
+func (e *HandlerError) Error() string {
+	if e.Message == "" {
+		return response.StatusText(e.StatusCode)
+	}
+
+	return e.Message
+}
+
+// ErrorHandler is a Handler that can fail. A *HandlerError, or an error
+// wrapping one, is answered with its status and message and any other
+// error with 500. The status, headers and body the handler set are
+// dropped, headers set before it ran, by middleware for instance, are
+// kept. Errors after the response was written can only be logged.
+type ErrorHandler func(w *response.Writer, req *request.Request) error
+
+// ServeRequest runs h with its errors rendered by DefaultErrorPages
+func (h ErrorHandler) ServeRequest(w *response.Writer, req *request.Request) {
+	DefaultErrorPages.Handle(h)(w, req)
+}
+
+// ErrorPage writes the response for a failed request
+type ErrorPage func(w *response.Writer, req *request.Request, herr *HandlerError)
+
+// ErrorPages is a registry of pages by status code. Statuses without a page
+// get WriteError.
+type ErrorPages struct {
+	// Logger receives the errors that are not shown to the client,
+	// log.Default() if nil
+	Logger *log.Logger
+
+	mu    sync.RWMutex
+	pages map[response.StatusCode]ErrorPage
+}
+
+// DefaultErrorPages renders the errors of ErrorHandler.ServeRequest
+var DefaultErrorPages = &ErrorPages{}
+
+// Register sets the page for statusCode, a nil page removes it
+func (p *ErrorPages) Register(statusCode response.StatusCode, page ErrorPage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if page == nil {
+		delete(p.pages, statusCode)
+		return
+	}
+
+	if p.pages == nil {
+		p.pages = make(map[response.StatusCode]ErrorPage)
+	}
+	p.pages[statusCode] = page
+}
+
+// Render writes herr with the page registered for its status
+func (p *ErrorPages) Render(w *response.Writer, req *request.Request, herr *HandlerError) {
+	p.mu.RLock()
+	page := p.pages[herr.StatusCode]
+	p.mu.RUnlock()
+
+	if page == nil {
+		page = WriteError
+	}
+	page(w, req, herr)
+}
+
+// Handle turns h into a Handler with its errors rendered by p
+func (p *ErrorPages) Handle(h ErrorHandler) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		before := maps.Clone(w.Header())
+
+		err := h(w, req)
+		if err == nil {
+			return
+		}
+
+		method, target := "-", "-"
+		if req != nil {
+			method, target = req.RequestLine.Method, req.RequestLine.RequestTarget
+		}
+
+		if w.Hijacked() || w.Reset() != nil {
+			p.logf("%s %s: %v after the response was written", method, target, err)
+			return
+		}
+		maps.Copy(w.Header(), before)
+
+		var herr *HandlerError
+		if !errors.As(err, &herr) {
+			// The details of unexpected errors stay in the log
+			p.logf("%s %s: %v", method, target, err)
+			herr = &HandlerError{StatusCode: response.StatusServerError}
+		}
+
+		p.Render(w, req, herr)
+	}
+}
+
+func (p *ErrorPages) logf(format string, args ...any) {
+	if p.Logger != nil {
+		p.Logger.Printf(format, args...)
+		return
+	}
+
+	log.Printf(format, args...)
+}
+
+// problem is an RFC 9457 problem details object
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+const errorHTML = `<html>
+  <head>
+    <title>%d %s</title>
+  </head>
+  <body>
+    <h1>%s</h1>
+    <p>%s</p>
+  </body>
+</html>
+`
+
+// WriteError writes herr as HTML, RFC 9457 problem details or plain text,
+// whichever the request's Accept header prefers, plain text by default
+func WriteError(w *response.Writer, req *request.Request, herr *HandlerError) {
+	statusCode := herr.StatusCode
+	if statusCode == 0 {
+		statusCode = response.StatusServerError
+	}
+	title := response.StatusText(statusCode)
+	detail := herr.Message
+
+	accept := ""
+	if req != nil {
+		accept = req.Get("Accept")
+	}
+
+	w.SetStatus(statusCode)
+	switch response.NegotiateType(accept, "text/plain", "text/html", "application/problem+json", "application/json") {
+	case "text/html":
+		if detail == "" {
+			detail = title
+		}
+		w.Header().Set("content-type", "text/html")
+		fmt.Fprintf(w, errorHTML, statusCode, title, title, html.EscapeString(detail))
+	case "application/problem+json", "application/json":
+		w.Header().Set("content-type", "application/problem+json")
+		json.NewEncoder(w).Encode(problem{
+			Type:   "about:blank",
+			Title:  title,
+			Status: int(statusCode),
+			Detail: detail,
+		})
+	default:
+		if detail == "" {
+			detail = title
+		}
+		w.Header().Set("content-type", "text/plain")
+		w.Write([]byte(detail))
+	}
+}
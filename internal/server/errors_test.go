@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"testing"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorHandler(t *testing.T) {
+	failWith := func(err error) ErrorHandler {
+		return func(w *response.Writer, req *request.Request) error {
+			w.SetStatus(response.StatusOk)
+			w.Header().Set("etag", `"stale"`)
+			w.Write([]byte("partial"))
+			return err
+		}
+	}
+
+	get := func(handler Handler, accept string) *response.Response {
+		req := &request.Request{
+			RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/users/7", HttpVersion: "1.1"},
+			Headers:     headers.NewHeaders(),
+		}
+		if accept != "" {
+			req.Headers.Set("Accept", accept)
+		}
+		buf := &bytes.Buffer{}
+		w := &response.Writer{W: buf}
+		handler(w, req)
+		require.NoError(t, w.Close())
+
+		res, err := response.ResponseFromReader(buf)
+		require.NoError(t, err)
+		return res
+	}
+
+	notFound := &HandlerError{StatusCode: response.StatusNotFound, Message: "No user <7>"}
+
+	// Test: No error leaves the response alone
+	res := get(failWith(nil).ServeRequest, "")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "partial", string(res.Body))
+
+	// Test: HandlerError replaces the buffered response, plain text by default
+	res = get(failWith(notFound).ServeRequest, "")
+	assert.Equal(t, response.StatusNotFound, res.StatusLine.StatusCode)
+	assert.Equal(t, "text/plain", res.Headers.Get("content-type"))
+	assert.Empty(t, res.Headers.Get("etag"))
+	assert.Equal(t, "No user <7>", string(res.Body))
+
+	// Test: Wrapped HandlerError as problem details
+	res = get(failWith(fmt.Errorf("loading user: %w", notFound)).ServeRequest, "application/json")
+	assert.Equal(t, response.StatusNotFound, res.StatusLine.StatusCode)
+	assert.Equal(t, "application/problem+json", res.Headers.Get("content-type"))
+	var details map[string]any
+	require.NoError(t, json.Unmarshal(res.Body, &details))
+	assert.Equal(t, map[string]any{
+		"type":   "about:blank",
+		"title":  "Not Found",
+		"status": float64(404),
+		"detail": "No user <7>",
+	}, details)
+
+	// Test: HTML for browsers, escaped
+	res = get(failWith(notFound).ServeRequest, "text/html,application/xhtml+xml,*/*;q=0.8")
+	assert.Equal(t, "text/html", res.Headers.Get("content-type"))
+	assert.Contains(t, string(res.Body), "<title>404 Not Found</title>")
+	assert.Contains(t, string(res.Body), "No user &lt;7&gt;")
+
+	// Test: Other errors are 500 without their details
+	res = get(failWith(errors.New("database password is hunter2")).ServeRequest, "")
+	assert.Equal(t, response.StatusCode(response.StatusServerError), res.StatusLine.StatusCode)
+	assert.Equal(t, "Internal Server Error", string(res.Body))
+
+	// Test: Registered pages replace the default
+	pages := &ErrorPages{}
+	pages.Register(response.StatusNotFound, func(w *response.Writer, req *request.Request, herr *HandlerError) {
+		w.SetStatus(herr.StatusCode)
+		w.Write([]byte("custom: " + herr.Message))
+	})
+	res = get(pages.Handle(failWith(notFound)), "")
+	assert.Equal(t, response.StatusNotFound, res.StatusLine.StatusCode)
+	assert.Equal(t, "custom: No user <7>", string(res.Body))
+
+	res = get(pages.Handle(failWith(errors.New("boom"))), "")
+	assert.Equal(t, "Internal Server Error", string(res.Body))
+
+	// Test: Headers set before the handler ran survive the error
+	secured := func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			w.Header().Set("x-frame-options", "DENY")
+			next(w, req)
+		}
+	}
+	res = get(secured(failWith(notFound).ServeRequest), "")
+	assert.Equal(t, response.StatusNotFound, res.StatusLine.StatusCode)
+	assert.Equal(t, "DENY", res.Headers.Get("x-frame-options"))
+	assert.Empty(t, res.Headers.Get("etag"))
+
+	// Test: Unexpected errors logged once, to the pages' Logger
+	logs := &bytes.Buffer{}
+	pages.Logger = log.New(logs, "", 0)
+	get(pages.Handle(failWith(errors.New("boom"))), "")
+	assert.Equal(t, "GET /users/7: boom\n", logs.String())
+	logs.Reset()
+	get(pages.Handle(func(w *response.Writer, req *request.Request) error {
+		w.Write([]byte("sent"))
+		w.Flush()
+		return errors.New("late")
+	}), "")
+	assert.Equal(t, "GET /users/7: late after the response was written\n", logs.String())
+
+	// Test: Errors after the response was written keep what was sent
+	written := ErrorHandler(func(w *response.Writer, req *request.Request) error {
+		w.Write([]byte("sent"))
+		w.Flush()
+		return notFound
+	})
+	res = get(written.ServeRequest, "")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "sent", string(res.Body))
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/TJ-R/httpfromtcp/internal/response"
+)
+
+// LimitStrategy is what Serve does with connections over MaxConns
+type LimitStrategy int
+
+const (
+	// LimitPause stops accepting until a connection finishes, leaving new
+	// ones waiting in the listener's backlog
+	LimitPause LimitStrategy = iota
+	// LimitReject accepts the connection, answers 503 and closes it
+	LimitReject
+)
+
+const (
+	// Accept errors are retried after a delay doubling from
+	// minAcceptDelay up to maxAcceptDelay
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+
+	// refuseTimeout bounds writing the 503 to a connection over a limit
+	refuseTimeout = time.Second
+
+	// maxRefusing bounds the connections being answered 503 at once
+	maxRefusing = 64
+
+	// refuseDrainBytes is how much of the refused client's request is read
+	// so closing does not reset the connection before the 503 arrives
+	refuseDrainBytes = 64 << 10
+)
+
+// acceptDelay is the wait before retrying Accept after another failure
+func acceptDelay(last time.Duration) time.Duration {
+	if last == 0 {
+		return minAcceptDelay
+	}
+
+	return min(2*last, maxAcceptDelay)
+}
+
+// acceptTemporary reports whether an Accept error may clear up, such as
+// running out of file descriptors. A closed listener never does.
+func acceptTemporary(err error) bool {
+	if errors.Is(err, net.ErrClosed) {
+		return false
+	}
+
+	var temporary interface{ Temporary() bool }
+	if errors.As(err, &temporary) {
+		return temporary.Temporary()
+	}
+
+	return true
+}
+
+// acquireIP counts a connection from ip, false when ip is at MaxConnsPerIP
+func (s *Server) acquireIP(ip string) bool {
+	if s.MaxConnsPerIP <= 0 {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ipConns[ip] >= s.MaxConnsPerIP {
+		return false
+	}
+
+	if s.ipConns == nil {
+		s.ipConns = make(map[string]int)
+	}
+	s.ipConns[ip]++
+
+	return true
+}
+
+func (s *Server) releaseIP(ip string) {
+	if s.MaxConnsPerIP <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ipConns[ip]--
+	if s.ipConns[ip] <= 0 {
+		delete(s.ipConns, ip)
+	}
+}
+
+// remoteIP is the host part of the connection's remote address
+func remoteIP(rwc net.Conn) string {
+	addr := rwc.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
+
+// refuse answers a connection over a limit with 503 and closes it, in the
+// background. Past maxRefusing at once the connection is closed right away
+// so a flood cannot pile up refusals either.
+func (s *Server) refuse(rwc net.Conn) {
+	s.mu.Lock()
+	if s.state == Closed || len(s.refusing) >= maxRefusing {
+		s.mu.Unlock()
+		rwc.Close()
+		return
+	}
+
+	if s.refusing == nil {
+		s.refusing = make(map[net.Conn]struct{})
+	}
+	s.refusing[rwc] = struct{}{}
+	s.mu.Unlock()
+
+	go func() {
+		defer func() {
+			s.mu.Lock()
+			delete(s.refusing, rwc)
+			s.mu.Unlock()
+		}()
+
+		s.writeRefusal(rwc)
+	}()
+}
+
+func (s *Server) writeRefusal(rwc net.Conn) {
+	defer rwc.Close()
+
+	rwc.SetDeadline(time.Now().Add(refuseTimeout))
+	s.reject(rwc, bufio.NewWriter(rwc), response.StatusServiceUnavailable)
+
+	if cw, ok := rwc.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		io.Copy(io.Discard, io.LimitReader(rwc, refuseDrainBytes))
+	}
+}
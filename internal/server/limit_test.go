@@ -0,0 +1,176 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TJ-R/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnLimits(t *testing.T) {
+	dialGet := func(t *testing.T, addr string) *response.Response {
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		res, err := response.ResponseFromReader(conn)
+		require.NoError(t, err)
+		return res
+	}
+
+	for _, s := range []*Server{
+		{Handler: named("ok"), MaxConns: 1, LimitStrategy: LimitReject},
+		{Handler: named("ok"), MaxConnsPerIP: 1},
+	} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go s.Serve(l)
+
+		// Test: Connections over the limit get 503
+		first, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		require.Eventually(t, func() bool { return len(s.Connections()) == 1 }, time.Second, 10*time.Millisecond)
+
+		res := dialGet(t, l.Addr().String())
+		assert.Equal(t, response.StatusServiceUnavailable, res.StatusLine.StatusCode)
+		assert.Equal(t, "close", res.Headers.Get("connection"))
+
+		// Test: Room again once the first connection is done
+		first.Close()
+		require.Eventually(t, func() bool { return len(s.Connections()) == 0 }, time.Second, 10*time.Millisecond)
+		res = dialGet(t, l.Addr().String())
+		assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+
+		s.Close()
+	}
+
+	// Test: Past maxRefusing connections are closed without a 503
+	s := &Server{Handler: named("ok"), MaxConnsPerIP: 1}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Serve(l)
+
+	held, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer held.Close()
+	require.Eventually(t, func() bool { return len(s.Connections()) == 1 }, time.Second, 10*time.Millisecond)
+
+	refused := make([]net.Conn, maxRefusing)
+	for i := range refused {
+		refused[i], err = net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer refused[i].Close()
+	}
+	refusing := func() int {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.refusing)
+	}
+	require.Eventually(t, func() bool { return refusing() == maxRefusing }, time.Second, 10*time.Millisecond)
+
+	dropped, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer dropped.Close()
+	dropped.SetReadDeadline(time.Now().Add(time.Second))
+	data, _ := io.ReadAll(dropped)
+	assert.Empty(t, data)
+
+	// Test: Close ends the refusals in progress
+	s.Close()
+	assert.Zero(t, refusing())
+
+	// Test: Accept delay doubles up to a ceiling
+	assert.Equal(t, minAcceptDelay, acceptDelay(0))
+	assert.Equal(t, 2*minAcceptDelay, acceptDelay(minAcceptDelay))
+	assert.Equal(t, maxAcceptDelay, acceptDelay(maxAcceptDelay))
+
+	// Test: Failing Accept backs off instead of spinning
+	fl := &failingListener{errors: 3}
+	s = &Server{Logger: log.New(io.Discard, "", 0)}
+	start := time.Now()
+	served := make(chan error)
+	go func() { served <- s.Serve(fl) }()
+	require.Eventually(t, func() bool { return fl.calls() > 3 }, time.Second, time.Millisecond)
+	assert.GreaterOrEqual(t, time.Since(start), minAcceptDelay*7)
+
+	s.Close()
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+
+	// Test: Listener closed by its owner ends Serve
+	l, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s = &Server{Logger: log.New(io.Discard, "", 0)}
+	go func() { served <- s.Serve(l) }()
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return len(s.listeners) == 1
+	}, time.Second, time.Millisecond)
+	l.Close()
+	select {
+	case err := <-served:
+		assert.ErrorIs(t, err, net.ErrClosed)
+	case <-time.After(time.Second):
+		t.Fatal("Serve should return once its listener is closed")
+	}
+	assert.NoError(t, s.Close())
+}
+
+// failingListener fails its first Accepts, then waits to be closed
+type failingListener struct {
+	mu       sync.Mutex
+	errors   int
+	accepted int
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	l.accepted++
+	fail := l.accepted <= l.errors
+	if l.closed == nil {
+		l.closed = make(chan struct{})
+	}
+	closed := l.closed
+	l.mu.Unlock()
+
+	if fail {
+		return nil, errors.New("too many open files")
+	}
+
+	<-closed
+	return nil, net.ErrClosed
+}
+
+func (l *failingListener) calls() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.accepted
+}
+
+func (l *failingListener) Close() error {
+	l.mu.Lock()
+	if l.closed == nil {
+		l.closed = make(chan struct{})
+	}
+	l.mu.Unlock()
+
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *failingListener) Addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+)
+
+// Middleware wraps a Handler with behaviour that runs around it
+type Middleware func(Handler) Handler
+
+// Chain combines middlewares into one. The first runs outermost, so
+// Chain(a, b)(h) is a(b(h)).
+func Chain(middlewares ...Middleware) Middleware {
+	return func(handler Handler) Handler {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			handler = middlewares[i](handler)
+		}
+
+		return handler
+	}
+}
+
+// ObservedWriter records the status, headers and body size of the response
+// written through the Writer it wraps. Handlers keep writing to the
+// original Writer.
+type ObservedWriter struct {
+	*response.Writer
+
+	statusCode   response.StatusCode
+	headers      headers.Headers
+	bytesWritten int64
+}
+
+func ObserveWriter(w *response.Writer) *ObservedWriter {
+	o := &ObservedWriter{Writer: w}
+	w.Observe(o)
+
+	return o
+}
+
+func (o *ObservedWriter) WroteHeaders(statusCode response.StatusCode, h headers.Headers) {
+	o.statusCode = statusCode
+	o.headers = h
+}
+
+func (o *ObservedWriter) WroteBody(n int64) {
+	o.bytesWritten += n
+}
+
+// Status is the status code sent, or the one that will be sent if the
+// headers have not gone out yet
+func (o *ObservedWriter) Status() response.StatusCode {
+	if o.headers != nil {
+		return o.statusCode
+	}
+
+	if o.Writer.StatusCode != 0 {
+		return o.Writer.StatusCode
+	}
+
+	return response.StatusOk
+}
+
+// SentHeaders returns the headers as they went out, nil until then
+func (o *ObservedWriter) SentHeaders() headers.Headers {
+	return o.headers
+}
+
+// BytesWritten counts the body bytes the handler wrote, before compression
+func (o *ObservedWriter) BytesWritten() int64 {
+	return o.bytesWritten
+}
+
+// Logger logs the method, target, status, body size and duration of every
+// request. The response is finished before logging so the numbers are
+// final, middleware inside Logger still runs first.
+func Logger(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			start := time.Now()
+			o := ObserveWriter(w)
+
+			next(w, req)
+
+			if !w.Hijacked() {
+				if err := w.Close(); err != nil {
+					logger.Println(err)
+				}
+			}
+
+			method, target := "-", "-"
+			if req != nil {
+				method, target = req.RequestLine.Method, req.RequestLine.RequestTarget
+			}
+			logger.Printf("%s %s %d %d %s", method, target, o.Status(), o.BytesWritten(), time.Since(start))
+		}
+	}
+}
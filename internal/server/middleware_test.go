@@ -0,0 +1,74 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	// Test: First middleware runs outermost
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(w *response.Writer, req *request.Request) {
+				order = append(order, name+" in")
+				next(w, req)
+				order = append(order, name+" out")
+			}
+		}
+	}
+
+	handler := Chain(trace("a"), trace("b"))(func(w *response.Writer, req *request.Request) {
+		order = append(order, "handler")
+	})
+	handler(&response.Writer{W: &bytes.Buffer{}}, nil)
+	assert.Equal(t, []string{"a in", "b in", "handler", "b out", "a out"}, order)
+
+	// Test: Router middleware also wraps 404s
+	order = nil
+	router := NewRouter()
+	router.Use(trace("router"))
+	res, _ := serve(t, router, "GET", "/missing")
+	assert.Equal(t, response.StatusNotFound, res.StatusLine.StatusCode)
+	assert.Equal(t, []string{"router in", "router out"}, order)
+}
+
+func TestObservedWriter(t *testing.T) {
+	// Test: Status and size before the headers go out
+	w := &response.Writer{W: &bytes.Buffer{}}
+	o := ObserveWriter(w)
+	w.SetStatus(response.StatusNotFound)
+	w.Write([]byte("missing"))
+	assert.Equal(t, response.StatusNotFound, o.Status())
+	assert.Nil(t, o.SentHeaders())
+
+	// Test: Final values after the response is finished
+	require.NoError(t, w.Close())
+	assert.Equal(t, response.StatusNotFound, o.Status())
+	assert.Equal(t, int64(7), o.BytesWritten())
+	assert.Equal(t, "7", o.SentHeaders().Get("content-length"))
+
+	// Test: Body counted before compression
+	w = &response.Writer{W: &bytes.Buffer{}}
+	o = ObserveWriter(w)
+	w.EnableCompression("gzip")
+	w.Write([]byte(strings.Repeat("a", 5000)))
+	require.NoError(t, w.Close())
+	assert.Equal(t, int64(5000), o.BytesWritten())
+	assert.Equal(t, "gzip", o.SentHeaders().Get("content-encoding"))
+
+	// Test: Logger sees the finished response
+	logs := &bytes.Buffer{}
+	router := NewRouter()
+	router.Use(Logger(log.New(logs, "", 0)))
+	router.Get("/hello", named("hello"))
+	serve(t, router, "GET", "/hello")
+	assert.True(t, strings.HasPrefix(logs.String(), "GET /hello 200 5 "))
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+)
+
+// ClientCertPolicy is what a route asks of the client certificate. The
+// certificate itself is verified during the handshake, against ClientCAFile
+// or TLSConfig.ClientCAs, so only verified certificates count.
+type ClientCertPolicy int
+
+const (
+	// ClientCertNone ignores client certificates, the handler sees none
+	ClientCertNone ClientCertPolicy = iota
+	// ClientCertOptional passes the certificate on when the client sent one
+	ClientCertOptional
+	// ClientCertRequired answers 403 to clients without a certificate
+	ClientCertRequired
+)
+
+func (p ClientCertPolicy) String() string {
+	switch p {
+	case ClientCertNone:
+		return "none"
+	case ClientCertOptional:
+		return "optional"
+	case ClientCertRequired:
+		return "required"
+	default:
+		return "unknown"
+	}
+}
+
+// PeerIdentity is who a verified client certificate says the client is
+type PeerIdentity struct {
+	Subject        pkix.Name
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []net.IP
+	URIs           []*url.URL
+
+	// Chain is the verified chain, from the client's certificate to the
+	// trusted root
+	Chain []*x509.Certificate
+}
+
+// ClientIdentity returns the identity in the request's verified client
+// certificate, nil when there is none
+func ClientIdentity(req *request.Request) *PeerIdentity {
+	if req == nil || req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+		return nil
+	}
+
+	chain := req.TLS.VerifiedChains[0]
+	leaf := chain[0]
+	return &PeerIdentity{
+		Subject:        leaf.Subject,
+		DNSNames:       leaf.DNSNames,
+		EmailAddresses: leaf.EmailAddresses,
+		IPAddresses:    leaf.IPAddresses,
+		URIs:           leaf.URIs,
+		Chain:          chain,
+	}
+}
+
+// ClientCert applies policy to the routes it wraps. With mTLS enabled
+// clients may always present a certificate, this decides whether a route
+// needs one.
+func ClientCert(policy ClientCertPolicy) Middleware {
+	return func(next Handler) Handler {
+		return func(w *response.Writer, req *request.Request) {
+			switch policy {
+			case ClientCertRequired:
+				if ClientIdentity(req) == nil {
+					w.SetStatus(response.StatusForbidden)
+					w.Header().Set("content-type", "text/plain")
+					w.Write([]byte("Client certificate required"))
+					return
+				}
+			case ClientCertNone:
+				if req != nil && req.TLS != nil {
+					req = req.Clone(req.Context())
+					req.TLS.PeerCertificates = nil
+					req.TLS.VerifiedChains = nil
+				}
+			}
+
+			next(w, req)
+		}
+	}
+}
+
+// LoadCertPool reads the PEM certificates in files into a pool
+func LoadCertPool(files ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("No certificates in %s", file)
+		}
+	}
+
+	return pool, nil
+}
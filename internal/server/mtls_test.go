@@ -0,0 +1,107 @@
+package server
+
+import (
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCert(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, cert := writeCert(t, filepath.Join(dir, "server"), "localhost", nil)
+	clientCertFile, clientKeyFile, _ := writeCert(t, filepath.Join(dir, "client"), "billing.internal", nil)
+	otherCertFile, otherKeyFile, _ := writeCert(t, filepath.Join(dir, "other"), "other.internal", nil)
+
+	identify := func(w *response.Writer, req *request.Request) {
+		id := ClientIdentity(req)
+		if id == nil {
+			w.Write([]byte("anonymous"))
+			return
+		}
+		w.Write([]byte(id.Subject.CommonName + " " + id.DNSNames[0]))
+	}
+
+	router := NewRouter()
+	router.Get("/public", ClientCert(ClientCertNone)(identify))
+	router.Get("/optional", ClientCert(ClientCertOptional)(identify))
+	router.Get("/admin", ClientCert(ClientCertRequired)(identify))
+
+	s := &Server{
+		Handler:      router.ServeRequest,
+		ClientCAFile: clientCertFile,
+		Logger:       log.New(io.Discard, "", 0),
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.ServeTLS(l, certFile, keyFile)
+	defer s.Close()
+
+	addr := l.Addr().String()
+	config := func(certFile, keyFile string) *tls.Config {
+		config := &tls.Config{ServerName: "localhost", RootCAs: certPool(cert)}
+		if certFile != "" {
+			clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			require.NoError(t, err)
+			// Sent even when the server does not list its issuer
+			config.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &clientCert, nil
+			}
+		}
+		return config
+	}
+
+	// Test: Required route with a trusted certificate
+	res := tlsGet(t, addr, "/admin", config(clientCertFile, clientKeyFile))
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "billing.internal billing.internal", string(res.Body))
+
+	// Test: Required route without a certificate
+	res = tlsGet(t, addr, "/admin", config("", ""))
+	assert.Equal(t, response.StatusForbidden, res.StatusLine.StatusCode)
+
+	// Test: Optional route with and without a certificate
+	res = tlsGet(t, addr, "/optional", config(clientCertFile, clientKeyFile))
+	assert.Equal(t, "billing.internal billing.internal", string(res.Body))
+	res = tlsGet(t, addr, "/optional", config("", ""))
+	assert.Equal(t, "anonymous", string(res.Body))
+
+	// Test: Routes with no policy hide the certificate
+	res = tlsGet(t, addr, "/public", config(clientCertFile, clientKeyFile))
+	assert.Equal(t, "anonymous", string(res.Body))
+
+	// Test: Certificates from an unknown CA fail the handshake
+	conn, err := tls.Dial("tcp", addr, config(otherCertFile, otherKeyFile))
+	if err == nil {
+		// With TLS 1.3 the client learns of the failure on its first read
+		conn.Write([]byte("GET /optional HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		_, err = conn.Read(make([]byte, 1))
+		conn.Close()
+	}
+	assert.Error(t, err)
+
+	// Test: TLSConfig.ClientCAs alone is enough to ask for certificates
+	pool, err := LoadCertPool(clientCertFile)
+	require.NoError(t, err)
+	s2 := &Server{
+		Handler:   router.ServeRequest,
+		TLSConfig: &tls.Config{ClientCAs: pool},
+		Logger:    log.New(io.Discard, "", 0),
+	}
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s2.ServeTLS(l2, certFile, keyFile)
+	defer s2.Close()
+	res = tlsGet(t, l2.Addr().String(), "/admin", config(clientCertFile, clientKeyFile))
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+
+	// Test: Plain requests have no identity
+	assert.Nil(t, ClientIdentity(&request.Request{}))
+}
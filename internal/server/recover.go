@@ -0,0 +1,55 @@
+package server
+
+import (
+	"bufio"
+	"net"
+	"runtime"
+
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+)
+
+// panicStackSize bounds the stack trace logged for a panic
+const panicStackSize = 64 << 10
+
+// recoverPanic deals with a panic p raised while reading or handling req
+// on rwc, so it only takes down that connection. The client gets 500 when
+// none of the response has been written. Otherwise the connection is
+// aborted so a truncated response is not mistaken for a complete one.
+func (s *Server) recoverPanic(c *conn, bw *bufio.Writer, writer *response.Writer, req *request.Request, p any) {
+	stack := make([]byte, panicStackSize)
+	stack = stack[:runtime.Stack(stack, false)]
+
+	method, target := "-", "-"
+	if req != nil {
+		method, target = req.RequestLine.Method, req.RequestLine.RequestTarget
+	}
+	s.logf("Panic serving %s %s from %s: %v\n%s", method, target, c.RemoteAddr(), p, stack)
+
+	if writer != nil && writer.Hijacked() {
+		// Nobody is left to close it
+		c.Conn.Close()
+		return
+	}
+
+	if writer == nil || !writer.Written() {
+		c.Conn.SetWriteDeadline(deadline(s.WriteTimeout))
+		s.reject(c.Conn, bw, response.StatusServerError)
+		return
+	}
+
+	// Drop what is still buffered and reset the connection
+	bw.Reset(nil)
+	if tcpConn, ok := netConn(c.Conn).(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+}
+
+// netConn is the connection under any TLS layer
+func netConn(rwc net.Conn) net.Conn {
+	if tlsConn, ok := rwc.(interface{ NetConn() net.Conn }); ok {
+		return tlsConn.NetConn()
+	}
+
+	return rwc
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecover(t *testing.T) {
+	router := NewRouter()
+	router.Get("/ok", named("ok"))
+	router.Get("/early", func(w *response.Writer, req *request.Request) {
+		w.Write([]byte("buffered, never sent"))
+		panic("early")
+	})
+	router.Get("/late", func(w *response.Writer, req *request.Request) {
+		h := headers.NewHeaders()
+		h.Set("content-length", "100")
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(h)
+		w.WriteBody([]byte("partial"))
+		w.Flush()
+		panic("late")
+	})
+
+	logs := &lockedBuffer{}
+	s := &Server{Handler: router.ServeRequest, Logger: log.New(logs, "", 0)}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Serve(l)
+	defer s.Close()
+
+	get := func(target string) (*response.Response, error) {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Write([]byte("GET " + target + " HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		return response.ResponseFromReader(conn)
+	}
+
+	// Test: Panic before anything is written gets 500 and a closed connection
+	res, err := get("/early")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCode(response.StatusServerError), res.StatusLine.StatusCode)
+	assert.Equal(t, "close", res.Headers.Get("connection"))
+	assert.Contains(t, logs.String(), "Panic serving GET /early")
+	assert.Contains(t, logs.String(), "recover_test.go")
+
+	// Test: Panic mid response aborts the connection
+	_, err = get("/late")
+	assert.Error(t, err)
+
+	// Test: The server keeps serving
+	res, err = get("/ok")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", string(res.Body))
+}
+
+// lockedBuffer is a bytes.Buffer safe to log to from connection goroutines
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.buf.String()
+}
@@ -0,0 +1,451 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+)
+
+// Segment kinds, ordered from most to least specific
+const (
+	literalSegment = iota
+	paramSegment
+	wildcardSegment
+)
+
+type segment struct {
+	kind int
+	// Literal text, or the parameter name. Empty for the unnamed wildcard
+	// a mounted router sits behind.
+	value string
+}
+
+type route struct {
+	method   string
+	segments []segment
+	handler  Handler
+	mount    *Router
+}
+
+// Router dispatches requests to handlers registered by method and path
+// pattern. Patterns are slash separated segments: literals, parameters
+// written {name}, and a final wildcard, * or {name...}, that matches the
+// rest of the path. Captured values are available through req.Param, the
+// plain * wildcard under "*".
+//
+// When several patterns match, the most specific wins: literals beat
+// parameters and parameters beat wildcards, comparing from the left. GET
+// routes also answer HEAD, OPTIONS is answered from the registered methods
+// and paths registered only for other methods get 405 with an Allow header.
+type Router struct {
+	routes      []*route
+	middlewares []Middleware
+
+	// NotFound and MethodNotAllowed replace the default plain text
+	// responses
+	NotFound         Handler
+	MethodNotAllowed Handler
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// Handle registers handler for method and pattern. It panics when the
+// pattern is malformed, as that is a programming error.
+func (r *Router) Handle(method, pattern string, handler Handler) {
+	segments, err := parsePattern(pattern)
+	if err != nil {
+		panic(err)
+	}
+
+	r.routes = append(r.routes, &route{
+		method:   strings.ToUpper(method),
+		segments: segments,
+		handler:  handler,
+	})
+}
+
+func (r *Router) Get(pattern string, handler Handler) {
+	r.Handle("GET", pattern, handler)
+}
+
+func (r *Router) Post(pattern string, handler Handler) {
+	r.Handle("POST", pattern, handler)
+}
+
+func (r *Router) Put(pattern string, handler Handler) {
+	r.Handle("PUT", pattern, handler)
+}
+
+func (r *Router) Patch(pattern string, handler Handler) {
+	r.Handle("PATCH", pattern, handler)
+}
+
+func (r *Router) Delete(pattern string, handler Handler) {
+	r.Handle("DELETE", pattern, handler)
+}
+
+// Mount hands every request under prefix to sub, which sees the path with
+// the prefix removed. Parameters in the prefix stay visible to sub's
+// handlers.
+func (r *Router) Mount(prefix string, sub *Router) {
+	prefix = strings.TrimSuffix(prefix, "/")
+	if prefix == "" {
+		prefix = "/"
+	}
+
+	segments, err := parsePattern(prefix)
+	if err != nil {
+		panic(err)
+	}
+
+	if len(segments) > 0 && segments[len(segments)-1].kind == wildcardSegment {
+		panic(fmt.Errorf("Mount prefix cannot end in a wildcard: %s", prefix))
+	}
+
+	r.routes = append(r.routes, &route{
+		segments: append(segments, segment{kind: wildcardSegment}),
+		mount:    sub,
+	})
+}
+
+// Use adds middleware that runs around every request the router serves,
+// including the 404 and 405 responses. A mounted router runs its own
+// middleware inside the parent's.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// ServeRequest is the router's Handler, pass it to Serve
+func (r *Router) ServeRequest(w *response.Writer, req *request.Request) {
+	if req == nil {
+		w.SetStatus(response.StatusClientError)
+		return
+	}
+
+	r.serve(w, req, splitPath(req.Path()))
+}
+
+func (r *Router) serve(w *response.Writer, req *request.Request, parts []string) {
+	handler := func(w *response.Writer, req *request.Request) {
+		r.dispatch(w, req, parts)
+	}
+
+	Chain(r.middlewares...)(handler)(w, req)
+}
+
+func (r *Router) dispatch(w *response.Writer, req *request.Request, parts []string) {
+	method := req.RequestLine.Method
+
+	// OPTIONS * asks about the server as a whole
+	if method == "OPTIONS" && req.RequestLine.RequestTarget == "*" {
+		w.Header().Set("allow", formatAllow(r.allMethods()))
+		w.SetStatus(response.StatusNoContent)
+		return
+	}
+
+	rt, params := r.lookup(method, parts)
+	if rt == nil && method == "HEAD" {
+		rt, params = r.lookup("GET", parts)
+	}
+
+	if rt == nil && !r.routesPath(parts) {
+		// With no route of the router's own over the path, a mount over it
+		// answers with its own 404, 405 and OPTIONS
+		rt, params = r.lookupMount(parts)
+	}
+
+	if rt == nil {
+		allowed := r.allowed(parts)
+		switch {
+		case len(allowed) > 0 && method == "OPTIONS":
+			w.Header().Set("allow", formatAllow(allowed))
+			w.SetStatus(response.StatusNoContent)
+		case len(allowed) > 0:
+			w.Header().Set("allow", formatAllow(allowed))
+			r.methodNotAllowed(w, req)
+		default:
+			r.notFound(w, req)
+		}
+		return
+	}
+
+	if req.Params == nil {
+		req.Params = make(map[string]string, len(params))
+	}
+	for name, value := range params {
+		req.Params[name] = value
+	}
+
+	if rt.mount != nil {
+		rt.mount.serve(w, req, rt.rest(parts))
+		return
+	}
+
+	rt.handler(w, req)
+}
+
+// lookup finds the most specific route for method and path. Mounts that do
+// not route method for the rest of the path are skipped so less specific
+// routes get their turn, and none of the mount's parameters end up on the
+// request.
+func (r *Router) lookup(method string, parts []string) (*route, map[string]string) {
+	var best *route
+	var bestParams map[string]string
+
+	for _, rt := range r.routes {
+		if rt.mount == nil && rt.method != method {
+			continue
+		}
+
+		params, ok := match(rt.segments, parts)
+		if !ok {
+			continue
+		}
+
+		if rt.mount != nil && !rt.mount.handles(method, rt.rest(parts)) {
+			continue
+		}
+
+		if best == nil || moreSpecific(rt.segments, best.segments) {
+			best, bestParams = rt, params
+		}
+	}
+
+	return best, bestParams
+}
+
+// handles reports whether the router has a route for method and path, HEAD
+// falling back to GET as in dispatch
+func (r *Router) handles(method string, parts []string) bool {
+	if rt, _ := r.lookup(method, parts); rt != nil {
+		return true
+	}
+
+	return method == "HEAD" && r.handles("GET", parts)
+}
+
+// routesPath reports whether any route of the router's own, not a mount,
+// is over path
+func (r *Router) routesPath(parts []string) bool {
+	for _, rt := range r.routes {
+		if rt.mount != nil {
+			continue
+		}
+
+		if _, ok := match(rt.segments, parts); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// lookupMount finds the most specific mount over path, whatever it routes
+func (r *Router) lookupMount(parts []string) (*route, map[string]string) {
+	var best *route
+	var bestParams map[string]string
+
+	for _, rt := range r.routes {
+		if rt.mount == nil {
+			continue
+		}
+
+		params, ok := match(rt.segments, parts)
+		if !ok {
+			continue
+		}
+
+		if best == nil || moreSpecific(rt.segments, best.segments) {
+			best, bestParams = rt, params
+		}
+	}
+
+	return best, bestParams
+}
+
+// rest is the part of the path a mount route hands to its router
+func (rt *route) rest(parts []string) []string {
+	return parts[len(rt.segments)-1:]
+}
+
+// allowed lists the methods registered for a path, the router's own and
+// those of mounts over it
+func (r *Router) allowed(parts []string) []string {
+	var methods []string
+
+	for _, rt := range r.routes {
+		if _, ok := match(rt.segments, parts); !ok {
+			continue
+		}
+
+		if rt.mount != nil {
+			methods = append(methods, rt.mount.allowed(rt.rest(parts))...)
+			continue
+		}
+		methods = append(methods, rt.method)
+	}
+
+	return methods
+}
+
+func (r *Router) allMethods() []string {
+	var methods []string
+
+	for _, rt := range r.routes {
+		if rt.mount != nil {
+			methods = append(methods, rt.mount.allMethods()...)
+			continue
+		}
+		methods = append(methods, rt.method)
+	}
+
+	return methods
+}
+
+func (r *Router) notFound(w *response.Writer, req *request.Request) {
+	if r.NotFound != nil {
+		r.NotFound(w, req)
+		return
+	}
+
+	w.SetStatus(response.StatusNotFound)
+	w.Header().Set("content-type", "text/plain")
+	w.Write([]byte(response.StatusText(response.StatusNotFound)))
+}
+
+func (r *Router) methodNotAllowed(w *response.Writer, req *request.Request) {
+	if r.MethodNotAllowed != nil {
+		r.MethodNotAllowed(w, req)
+		return
+	}
+
+	w.SetStatus(response.StatusMethodNotAllowed)
+	w.Header().Set("content-type", "text/plain")
+	w.Write([]byte(response.StatusText(response.StatusMethodNotAllowed)))
+}
+
+// formatAllow builds the Allow header value. HEAD comes with GET and OPTIONS
+// is always answered.
+func formatAllow(methods []string) string {
+	methods = append(methods, "OPTIONS")
+	if slices.Contains(methods, "GET") {
+		methods = append(methods, "HEAD")
+	}
+
+	slices.Sort(methods)
+	return strings.Join(slices.Compact(methods), ", ")
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("Pattern must start with /: %q", pattern)
+	}
+
+	parts := splitPath(pattern)
+	segments := make([]segment, 0, len(parts))
+	names := map[string]bool{}
+
+	for i, part := range parts {
+		seg := segment{kind: literalSegment, value: part}
+
+		switch {
+		case part == "*":
+			seg = segment{kind: wildcardSegment, value: "*"}
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "...}"):
+			seg = segment{kind: wildcardSegment, value: part[1 : len(part)-4]}
+		case strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}"):
+			seg = segment{kind: paramSegment, value: part[1 : len(part)-1]}
+		}
+
+		if seg.kind != literalSegment {
+			if seg.value == "" || strings.ContainsAny(seg.value, "{}") {
+				return nil, fmt.Errorf("Invalid parameter %q in pattern %q", part, pattern)
+			}
+			if names[seg.value] {
+				return nil, fmt.Errorf("Duplicate parameter %q in pattern %q", seg.value, pattern)
+			}
+			names[seg.value] = true
+		}
+
+		if seg.kind == wildcardSegment && i != len(parts)-1 {
+			return nil, fmt.Errorf("Wildcard must be the last segment in pattern %q", pattern)
+		}
+
+		segments = append(segments, seg)
+	}
+
+	return segments, nil
+}
+
+// splitPath splits a path into its segments, the root path has none
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil
+	}
+
+	return strings.Split(path, "/")
+}
+
+func match(segments []segment, parts []string) (map[string]string, bool) {
+	params := map[string]string{}
+
+	for i, seg := range segments {
+		if seg.kind == wildcardSegment {
+			if seg.value != "" {
+				params[seg.value] = unescape(strings.Join(parts[i:], "/"))
+			}
+			return params, true
+		}
+
+		if i >= len(parts) {
+			return nil, false
+		}
+
+		switch seg.kind {
+		case literalSegment:
+			if parts[i] != seg.value {
+				return nil, false
+			}
+		case paramSegment:
+			if parts[i] == "" {
+				return nil, false
+			}
+			params[seg.value] = unescape(parts[i])
+		}
+	}
+
+	if len(parts) != len(segments) {
+		return nil, false
+	}
+
+	return params, true
+}
+
+// moreSpecific reports whether pattern a should win over b when both match
+// the same path
+func moreSpecific(a, b []segment) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].kind != b[i].kind {
+			return a[i].kind < b[i].kind
+		}
+	}
+
+	// The longer pattern can only match as well by ending in a wildcard
+	// that matched nothing, the exact one is preferred
+	return len(a) < len(b)
+}
+
+func unescape(s string) string {
+	if unescaped, err := url.PathUnescape(s); err == nil {
+		return unescaped
+	}
+
+	return s
+}
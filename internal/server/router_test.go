@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	router := NewRouter()
+	router.Get("/", named("root"))
+	router.Get("/users/{id}", named("user"))
+	router.Get("/users/me", named("me"))
+	router.Delete("/users/{id}", named("delete"))
+	router.Get("/static/*", named("static"))
+	router.Get("/files/{path...}", named("files"))
+
+	api := NewRouter()
+	api.Get("/health", named("health"))
+	api.Post("/orgs/{org}/repos", named("repos"))
+	router.Mount("/api/{version}", api)
+
+	// Test: Root path
+	res, req := serve(t, router, "GET", "/")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "root", string(res.Body))
+
+	// Test: Named parameter, query string ignored
+	res, req = serve(t, router, "GET", "/users/42?verbose=1")
+	assert.Equal(t, "user", string(res.Body))
+	assert.Equal(t, "42", req.Param("id"))
+
+	// Test: Literal beats parameter
+	res, _ = serve(t, router, "GET", "/users/me")
+	assert.Equal(t, "me", string(res.Body))
+
+	// Test: Other method on the same pattern
+	res, req = serve(t, router, "DELETE", "/users/7")
+	assert.Equal(t, "delete", string(res.Body))
+	assert.Equal(t, "7", req.Param("id"))
+
+	// Test: Wildcards capture the rest of the path
+	_, req = serve(t, router, "GET", "/static/css/site.css")
+	assert.Equal(t, "css/site.css", req.Param("*"))
+	_, req = serve(t, router, "GET", "/files/a%20b/c.txt")
+	assert.Equal(t, "a b/c.txt", req.Param("path"))
+
+	// Test: Mounted router sees the rest of the path and the prefix params
+	res, req = serve(t, router, "POST", "/api/v2/orgs/acme/repos")
+	assert.Equal(t, "repos", string(res.Body))
+	assert.Equal(t, "v2", req.Param("version"))
+	assert.Equal(t, "acme", req.Param("org"))
+
+	// Test: Unknown path
+	res, _ = serve(t, router, "GET", "/nope")
+	assert.Equal(t, response.StatusNotFound, res.StatusLine.StatusCode)
+	res, _ = serve(t, router, "GET", "/api/v1/nope")
+	assert.Equal(t, response.StatusNotFound, res.StatusLine.StatusCode)
+
+	// Test: Mount with nothing for the path falls through without its params
+	router.Get("/api/*", named("api fallback"))
+	res, req = serve(t, router, "GET", "/api/v1/nope")
+	assert.Equal(t, "api fallback", string(res.Body))
+	assert.Equal(t, "v1/nope", req.Param("*"))
+	assert.NotContains(t, req.Params, "version")
+
+	// Test: Mount answers its own 404 when nothing else matches
+	api.NotFound = named("api not found")
+	other := NewRouter()
+	other.Mount("/api/{version}", api)
+	res, _ = serve(t, other, "GET", "/api/v1/nope")
+	assert.Equal(t, "api not found", string(res.Body))
+	api.NotFound = nil
+
+	// Test: Mount and parent routes on the same path, by method
+	parent := NewRouter()
+	parent.Get("/api/users", named("list"))
+	users := NewRouter()
+	users.Post("/users", named("create"))
+	parent.Mount("/api", users)
+	res, _ = serve(t, parent, "GET", "/api/users")
+	assert.Equal(t, "list", string(res.Body))
+	res, _ = serve(t, parent, "HEAD", "/api/users")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	res, _ = serve(t, parent, "POST", "/api/users")
+	assert.Equal(t, "create", string(res.Body))
+	res, _ = serve(t, parent, "OPTIONS", "/api/users")
+	assert.Equal(t, response.StatusNoContent, res.StatusLine.StatusCode)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", res.Get("Allow"))
+	res, _ = serve(t, parent, "DELETE", "/api/users")
+	assert.Equal(t, response.StatusMethodNotAllowed, res.StatusLine.StatusCode)
+	assert.Equal(t, "GET, HEAD, OPTIONS, POST", res.Get("Allow"))
+
+	// Test: Wrong method lists the allowed ones
+	res, _ = serve(t, router, "POST", "/users/7")
+	assert.Equal(t, response.StatusMethodNotAllowed, res.StatusLine.StatusCode)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS", res.Get("Allow"))
+	res, _ = serve(t, other, "GET", "/api/v1/orgs/acme/repos")
+	assert.Equal(t, response.StatusMethodNotAllowed, res.StatusLine.StatusCode)
+	assert.Equal(t, "OPTIONS, POST", res.Get("Allow"))
+
+	// Test: HEAD falls back to GET
+	res, _ = serve(t, router, "HEAD", "/users/me")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+
+	// Test: Automatic OPTIONS
+	res, _ = serve(t, router, "OPTIONS", "/users/me")
+	assert.Equal(t, response.StatusNoContent, res.StatusLine.StatusCode)
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS", res.Get("Allow"))
+	res, _ = serve(t, router, "OPTIONS", "*")
+	assert.Equal(t, "DELETE, GET, HEAD, OPTIONS, POST", res.Get("Allow"))
+
+	// Test: Custom not found handler
+	router.NotFound = func(w *response.Writer, req *request.Request) {
+		w.SetStatus(response.StatusNotFound)
+		w.Write([]byte("custom"))
+	}
+	res, _ = serve(t, router, "GET", "/missing")
+	assert.Equal(t, "custom", string(res.Body))
+
+	// Test: Malformed patterns
+	assert.Panics(t, func() { router.Get("no-slash", named("x")) })
+	assert.Panics(t, func() { router.Get("/a/*/b", named("x")) })
+	assert.Panics(t, func() { router.Get("/{id}/{id}", named("x")) })
+}
+
+func named(name string) Handler {
+	return func(w *response.Writer, req *request.Request) {
+		w.Write([]byte(name))
+	}
+}
+
+func serve(t *testing.T, router *Router, method, target string) (*response.Response, *request.Request) {
+	t.Helper()
+
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: method, RequestTarget: target, HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	buf := &bytes.Buffer{}
+	w := &response.Writer{W: buf, SuppressBody: method == "HEAD"}
+	router.ServeRequest(w, req)
+	require.NoError(t, w.Close())
+
+	res, err := response.ResponseFromReaderForMethod(buf, method)
+	require.NoError(t, err)
+	return res, req
+}
@@ -1,23 +1,96 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/TJ-R/httpfromtcp/internal/request"
 	"github.com/TJ-R/httpfromtcp/internal/response"
 )
 
+var ErrServerClosed = errors.New("Server closed")
+
+// Server serves HTTP/1.1 on the listeners given to Serve. The exported
+// fields configure it and must not be changed once it is serving.
 type Server struct {
-	state ServerState
-	listener net.Listener
-	handler Handler
-}
+	// Addr is the TCP address ListenAndServe listens on, ":http" if empty
+	Addr string
+
+	// Handler responds to every request. With no handler every request
+	// gets 404 Not Found.
+	Handler Handler
+
+	// ReadTimeout bounds reading a request. The first request on a
+	// connection is timed from the accept, TLS handshake included, later
+	// ones from their first byte after IdleTimeout.
+	ReadTimeout time.Duration
+
+	// WriteTimeout bounds handling a request and writing its response,
+	// from the end of the request
+	WriteTimeout time.Duration
+
+	// IdleTimeout bounds the wait for the next request on a kept alive
+	// connection, ReadTimeout if zero
+	IdleTimeout time.Duration
+
+	// MaxHeaderBytes limits the request line and headers,
+	// DefaultMaxHeaderBytes if zero. Larger requests get 431.
+	MaxHeaderBytes int
+
+	// MaxConns limits how many connections are served at once, what
+	// happens past it is up to LimitStrategy. No limit when zero.
+	MaxConns int
+
+	// LimitStrategy handles connections over MaxConns, pausing Accept by
+	// default
+	LimitStrategy LimitStrategy
+
+	// MaxConnsPerIP limits the connections served at once for one client
+	// IP. Connections past it get 503. No limit when zero.
+	MaxConnsPerIP int
 
-type HandlerError struct {
-	StatusCode response.StatusCode
-	Message    string
+	// DropTrailersWithoutTE leaves trailer fields off responses to clients
+	// that did not send TE: trailers
+	DropTrailersWithoutTE bool
+
+	// Logger receives errors from accepting connections and serving
+	// requests, log.Default() if nil
+	Logger *log.Logger
+
+	// BaseContext returns the context requests from a listener start
+	// from, context.Background() if nil
+	BaseContext func(net.Listener) context.Context
+
+	// TLSConfig is used by ServeTLS and ListenAndServeTLS, cloned before
+	// use. A CertStore's GetCertificate serves several hostnames.
+	TLSConfig *tls.Config
+
+	// ClientCAFile is a PEM bundle of the CAs client certificates are
+	// verified against. Clients may then present a certificate, which
+	// routes can require with ClientCert.
+	ClientCAFile string
+
+	state     ServerState
+	listeners map[net.Listener]struct{}
+	done      chan struct{}
+
+	mu         sync.Mutex
+	conns      map[*conn]struct{}
+	ipConns    map[string]int
+	refusing   map[net.Conn]struct{}
+	slots      chan struct{}
+	connState  func(net.Conn, ConnState)
+	inShutdown bool
+	onShutdown []func()
 }
 
 type ServerState int
@@ -29,56 +102,428 @@ const (
 	Closed
 )
 
+const writeBufferSize = 4096
+
+const DefaultMaxHeaderBytes = 1 << 20
+
+var bufioWriterPool = sync.Pool{
+	New: func() any {
+		return bufio.NewWriterSize(nil, writeBufferSize)
+	},
+}
+
+// Serve listens on port on every interface and serves handler in the
+// background. A Server gives control over the address, timeouts and limits.
 func Serve(port int, handler Handler) (*Server, error) {
 	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
-		return nil, err 
+		return nil, err
 	}
 
 	server := &Server {
-		state: Initalized,
-		listener: l,
-		handler: handler,
+		Addr: l.Addr().String(),
+		Handler: handler,
 	}
 
-	go server.listen(handler)	
+	go server.Serve(l)
 	return server, nil
 }
 
-func (s *Server) Close() error {
-	s.state = Closed
-	if s.listener != nil {
-		return s.listener.Close()
+// ListenAndServe listens on Addr and serves until the server is closed,
+// when it returns ErrServerClosed
+func (s *Server) ListenAndServe() error {
+	if s.closed() {
+		return ErrServerClosed
+	}
+
+	addr := s.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return s.Serve(l)
 }
 
-func (s *Server) listen(handlerFunc Handler) {
-	for s.state != Closed {
-		conn, err := s.listener.Accept()	
+// ListenAndServeTLS is ListenAndServe over TLS, see ServeTLS
+func (s *Server) ListenAndServeTLS(certFile, keyFile string) error {
+	if s.closed() {
+		return ErrServerClosed
+	}
+
+	addr := s.Addr
+	if addr == "" {
+		addr = ":https"
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.ServeTLS(l, certFile, keyFile)
+}
+
+// Serve accepts connections on l and serves each in its own goroutine. It
+// always returns an error, ErrServerClosed after Close or Shutdown, or the
+// Accept error that will not clear up, such as l being closed directly.
+func (s *Server) Serve(l net.Listener) error {
+	if !s.trackListener(l) {
+		l.Close()
+		return ErrServerClosed
+	}
+
+	baseCtx := context.Background()
+	if s.BaseContext != nil {
+		baseCtx = s.BaseContext(l)
+		if baseCtx == nil {
+			panic("BaseContext returned a nil context")
+		}
+	}
+
+	slots := s.connSlots()
+	release := func() {
+		if slots != nil {
+			<-slots
+		}
+	}
+
+	var delay time.Duration
+	for {
+		if slots != nil && s.LimitStrategy == LimitPause {
+			select {
+			case slots <- struct{}{}:
+			case <-s.doneChan():
+				return ErrServerClosed
+			}
+		}
+
+		conn, err := l.Accept()
 		if err != nil {
-			if s.state == Closed {
-				return
+			if s.closed() {
+				return ErrServerClosed
+			}
+			if slots != nil && s.LimitStrategy == LimitPause {
+				release()
 			}
-			log.Printf("Error accepting connection: %v", err)
+			if !acceptTemporary(err) {
+				s.untrackListener(l)
+				return err
+			}
+
+			// Errors such as running out of file descriptors last a while,
+			// back off instead of spinning
+			delay = acceptDelay(delay)
+			s.logf("Error accepting connection: %v; retrying in %v", err, delay)
+			select {
+			case <-time.After(delay):
+			case <-s.doneChan():
+				return ErrServerClosed
+			}
+			continue
+		}
+		delay = 0
+
+		if slots != nil && s.LimitStrategy == LimitReject {
+			select {
+			case slots <- struct{}{}:
+			default:
+				s.refuse(conn)
+				continue
+			}
+		}
+
+		ip := remoteIP(conn)
+		if !s.acquireIP(ip) {
+			release()
+			s.refuse(conn)
 			continue
 		}
-		go s.handle(conn)
+
+		// Tracked before serving so Close and Shutdown cannot miss it
+		c := s.trackConn(conn)
+		if c == nil {
+			s.releaseIP(ip)
+			release()
+			continue
+		}
+
+		go func() {
+			s.handle(c, baseCtx)
+			s.releaseIP(ip)
+			release()
+		}()
 	}
 }
 
-func (s *Server) handle(conn net.Conn) {
-	defer conn.Close()
+// Close stops the server immediately, closing the listener and every
+// connection including those with requests in flight. Use Shutdown to let
+// them finish.
+func (s *Server) Close() error {
+	err := s.closeListener()
+	s.closeConns(false)
+
+	return err
+}
+
+func (s *Server) closeListener() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	req, err := request.RequestFromReader(conn)
-	if err != nil {
-		log.Println(err)
+	if s.state != Closed {
+		s.state = Closed
+		if s.done != nil {
+			close(s.done)
+		}
 	}
 
-	writer := &response.Writer {
-		W: conn,
+	var err error
+	for l := range s.listeners {
+		if closeErr := l.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		delete(s.listeners, l)
 	}
 
-	s.handler(writer, req)
-} 
+	return err
+}
+
+// connSlots holds a token for every connection being served, shared by all
+// listeners so MaxConns bounds the server as a whole. Nil without a limit.
+func (s *Server) connSlots() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.slots == nil && s.MaxConns > 0 {
+		s.slots = make(chan struct{}, s.MaxConns)
+	}
+
+	return s.slots
+}
+
+func (s *Server) trackListener(l net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state == Closed {
+		return false
+	}
+
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+
+	return true
+}
+
+func (s *Server) untrackListener(l net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.listeners, l)
+}
+
+func (s *Server) closed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state == Closed
+}
+
+// doneChan is closed once the server is closed
+func (s *Server) doneChan() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done == nil {
+		s.done = make(chan struct{})
+		if s.state == Closed {
+			close(s.done)
+		}
+	}
+
+	return s.done
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+		return
+	}
+
+	log.Printf(format, args...)
+}
+
+func (s *Server) maxHeaderBytes() int {
+	if s.MaxHeaderBytes > 0 {
+		return s.MaxHeaderBytes
+	}
+
+	return DefaultMaxHeaderBytes
+}
+
+func (s *Server) idleTimeout() time.Duration {
+	if s.IdleTimeout > 0 {
+		return s.IdleTimeout
+	}
+
+	return s.ReadTimeout
+}
+
+// deadline is the time d from now, or no deadline when d is zero
+func deadline(d time.Duration) time.Time {
+	if d <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(d)
+}
+
+func (s *Server) handle(c *conn, baseCtx context.Context) {
+	rwc := c.Conn
+	if hook := s.connStateHook(); hook != nil {
+		hook(rwc, StateNew)
+	}
+	defer func() {
+		if c.getState() != StateHijacked {
+			rwc.Close()
+			c.setState(StateClosed)
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(baseCtx)
+	defer cancel()
+
+	handler := s.Handler
+	if handler == nil {
+		handler = NewRouter().ServeRequest
+	}
+
+	var tlsState *tls.ConnectionState
+	if tlsConn, ok := rwc.(*tls.Conn); ok {
+		rwc.SetDeadline(deadline(s.ReadTimeout))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			s.logf("TLS handshake error from %s: %v", rwc.RemoteAddr(), err)
+			return
+		}
+
+		state := tlsConn.ConnectionState()
+		tlsState = &state
+	}
+
+	bw := bufioWriterPool.Get().(*bufio.Writer)
+	bw.Reset(rwc)
+	defer func() {
+		bw.Reset(nil)
+		bufioWriterPool.Put(bw)
+	}()
+
+	// The request being served, for recovering from a panic
+	var req *request.Request
+	var writer *response.Writer
+	defer func() {
+		if p := recover(); p != nil {
+			s.recoverPanic(c, bw, writer, req, p)
+		}
+	}()
+
+	rwc.SetReadDeadline(deadline(s.ReadTimeout))
+	for {
+		var err error
+		req, writer = nil, nil
+		req, err = request.RequestFromReaderWithLimit(c, s.maxHeaderBytes())
+		if err != nil {
+			if c.getState() != StateActive {
+				// The client closed the connection between requests
+				return
+			}
+
+			// Whatever follows a request that could not be read cannot be
+			// told apart from it, so the connection is not reused
+			var netErr net.Error
+			statusCode := response.StatusCode(response.StatusClientError)
+			switch {
+			case errors.Is(err, request.ErrHeaderTooLarge):
+				statusCode = response.StatusRequestHeaderFieldsTooLarge
+			case errors.Is(err, request.ErrTransferEncoding):
+				statusCode = response.StatusNotImplemented
+			case errors.As(err, &netErr) && netErr.Timeout():
+				s.logf("Timed out reading request from %s", rwc.RemoteAddr())
+				return
+			default:
+				s.logf("%v", err)
+			}
+
+			rwc.SetWriteDeadline(deadline(s.WriteTimeout))
+			s.reject(rwc, bw, statusCode)
+			return
+		}
+
+		rwc.SetWriteDeadline(deadline(s.WriteTimeout))
+
+		req = req.WithContext(ctx)
+		req.TLS = tlsState
+		writer = &response.Writer {
+			W: bw,
+			AcceptsTrailers: response.AcceptsTrailers(req.Get("TE")),
+			DropTrailersWithoutTE: s.DropTrailersWithoutTE,
+			// HEAD runs the same handler as GET with the body left off
+			SuppressBody: req.RequestLine.Method == "HEAD",
+			KeepAlive: !response.HasToken(req.Get("Connection"), "close") && !s.shuttingDown(),
+		}
+		writer.EnableHijack(func() (net.Conn, *bufio.ReadWriter, error) {
+			// Hand over whatever the parser read past the end of the request
+			br := bufio.NewReader(io.MultiReader(bytes.NewReader(req.Leftover()), c.r))
+			// Timeouts are for HTTP, the new owner sets its own
+			rwc.SetDeadline(time.Time{})
+			c.setState(StateHijacked)
+			return rwc, bufio.NewReadWriter(br, bufio.NewWriter(rwc)), nil
+		})
+
+		handler(writer, req)
+
+		if writer.Hijacked() {
+			return
+		}
+
+		closeErr := writer.Close()
+		if closeErr != nil {
+			s.logf("%v", closeErr)
+		}
+
+		if err := bw.Flush(); err != nil {
+			s.logf("%v", err)
+			return
+		}
+
+		if closeErr != nil || !writer.KeepsAlive() || s.shuttingDown() {
+			return
+		}
+
+		// Idle until the next request starts arriving, which may already
+		// have been read along with this one
+		c.setState(StateIdle)
+		c.r = io.MultiReader(bytes.NewReader(req.Leftover()), c.r)
+		rwc.SetReadDeadline(deadline(s.idleTimeout()))
+	}
+}
+
+// reject answers a request that could not be read, or a connection that
+// could not be served, with statusCode before the connection is closed
+func (s *Server) reject(rwc net.Conn, bw *bufio.Writer, statusCode response.StatusCode) {
+	writer := &response.Writer{W: bw}
+	writer.SetStatus(statusCode)
+	writer.Write([]byte(response.StatusText(statusCode)))
+	if err := writer.Close(); err != nil {
+		s.logf("%v", err)
+	}
+
+	if err := bw.Flush(); err != nil {
+		s.logf("%v", err)
+	}
+}
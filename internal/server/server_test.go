@@ -0,0 +1,202 @@
+package server
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type contextKey struct{}
+
+func TestServerConfig(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &Server{
+		Handler: func(w *response.Writer, req *request.Request) {
+			value, _ := req.Context().Value(contextKey{}).(string)
+			w.Write([]byte(value))
+		},
+		IdleTimeout:    100 * time.Millisecond,
+		MaxHeaderBytes: 256,
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), contextKey{}, "from base")
+		},
+	}
+	served := make(chan error)
+	go func() {
+		served <- s.Serve(l)
+	}()
+
+	// Test: Requests see the base context
+	conn, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+
+	// Test: Idle connection is closed after IdleTimeout
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(data), "\r\n\r\nfrom base"))
+
+	// Test: Oversized headers get 431
+	conn, err = net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nX-Big: " + strings.Repeat("a", 512) + "\r\n\r\n"))
+	require.NoError(t, err)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	res, err := response.ResponseFromReader(conn)
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusRequestHeaderFieldsTooLarge, res.StatusLine.StatusCode)
+
+	// Test: Serve returns ErrServerClosed
+	require.NoError(t, s.Close())
+	assert.ErrorIs(t, <-served, ErrServerClosed)
+	assert.ErrorIs(t, s.ListenAndServe(), ErrServerClosed)
+}
+
+func TestMaxConns(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &Server{
+		Handler:  named("ok"),
+		MaxConns: 1,
+	}
+	go s.Serve(l)
+	defer s.Close()
+
+	// Test: Second connection waits until the first is done
+	first, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(s.Connections()) == 1 }, time.Second, 10*time.Millisecond)
+
+	second, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	_, err = second.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+
+	second.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = second.Read(make([]byte, 1))
+	require.Error(t, err)
+	assert.Len(t, s.Connections(), 1)
+
+	// Test: The limit covers every listener
+	other, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.Serve(other)
+	third, err := net.Dial("tcp", other.Addr().String())
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	assert.Len(t, s.Connections(), 1)
+	third.Close()
+
+	first.Close()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := io.ReadAll(second)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(data), "\r\n\r\nok"))
+}
+
+func TestDropTrailersWithoutTE(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &Server{
+		Handler: func(w *response.Writer, req *request.Request) {
+			w.DeclareTrailers("X-Checksum")
+			w.Write([]byte("body"))
+			w.Trailers = response.GetDefaultTrailers()
+			w.Trailers["X-Checksum"] = "abc"
+		},
+		DropTrailersWithoutTE: true,
+	}
+	go s.Serve(l)
+	defer s.Close()
+
+	get := func(te string) *response.Response {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n" + te + "Connection: close\r\n\r\n"))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		res, err := response.ResponseFromReader(conn)
+		require.NoError(t, err)
+		return res
+	}
+
+	// Test: Trailers sent to clients asking for them
+	res := get("TE: trailers\r\n")
+	assert.Equal(t, "x-checksum", res.Headers.Get("trailer"))
+	assert.Equal(t, "abc", res.Trailers.Get("x-checksum"))
+
+	// Test: Trailers left off for everybody else
+	res = get("")
+	assert.Empty(t, res.Headers.Get("trailer"))
+	assert.Empty(t, res.Trailers.Get("x-checksum"))
+	assert.Equal(t, "body", string(res.Body))
+}
+
+func TestBadRequests(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var served atomic.Int32
+	s := &Server{
+		Handler: func(w *response.Writer, req *request.Request) {
+			served.Add(1)
+			w.Write([]byte("ok"))
+		},
+		Logger: log.New(io.Discard, "", 0),
+	}
+	go s.Serve(l)
+	defer s.Close()
+
+	send := func(raw string) *response.Response {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+
+		_, err = conn.Write([]byte(raw))
+		require.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		res, err := response.ResponseFromReader(conn)
+		require.NoError(t, err)
+		assert.Empty(t, res.Leftover())
+
+		// Nothing after the request is served, the connection is closed
+		n, err := conn.Read(make([]byte, 1))
+		assert.Zero(t, n)
+		assert.Error(t, err)
+		return res
+	}
+
+	// Test: Chunked request bodies get 501
+	res := send("POST / HTTP/1.1\r\nHost: localhost\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\n")
+	assert.Equal(t, response.StatusNotImplemented, res.StatusLine.StatusCode)
+
+	// Test: Content-Length with Transfer-Encoding too
+	res = send("POST / HTTP/1.1\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nGET / HTTP/1.1\r\n\r\n")
+	assert.Equal(t, response.StatusNotImplemented, res.StatusLine.StatusCode)
+
+	// Test: Malformed requests get 400 without reaching the handler
+	res = send("0\r\n\r\n")
+	assert.Equal(t, response.StatusCode(response.StatusClientError), res.StatusLine.StatusCode)
+	assert.Zero(t, served.Load())
+}
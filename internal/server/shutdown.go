@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"time"
+)
+
+// How often Shutdown checks whether the connections have drained
+const shutdownPollInterval = 50 * time.Millisecond
+
+// RegisterOnShutdown adds a function to run when Shutdown starts. It is
+// meant for connections the server cannot drain itself, such as hijacked
+// websockets and event streams, which should be told to finish up.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onShutdown = append(s.onShutdown, f)
+}
+
+// Shutdown stops the server gracefully. It stops accepting connections,
+// closes the idle ones and waits for requests in flight to finish, closing
+// each connection once its response is sent. If ctx ends first the
+// remaining connections are closed and ctx's error returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.inShutdown = true
+	hooks := s.onShutdown
+	s.mu.Unlock()
+
+	err := s.closeListener()
+	for _, f := range hooks {
+		go f()
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if s.closeConns(true) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			s.closeConns(false)
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.inShutdown
+}
+
+// closeConns closes the tracked connections, only the idle ones when
+// idleOnly is set, and reports whether none are left. Connections being
+// refused are always closed, they were never going to be served.
+func (s *Server) closeConns(idleOnly bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for rwc := range s.refusing {
+		rwc.Close()
+		delete(s.refusing, rwc)
+	}
+
+	for c := range s.conns {
+		if idleOnly {
+			// New connections count as idle until a request starts
+			if state := c.getState(); state != StateIdle && state != StateNew {
+				continue
+			}
+		}
+
+		c.Conn.Close()
+		delete(s.conns, c)
+	}
+
+	return len(s.conns) == 0
+}
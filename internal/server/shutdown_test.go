@@ -0,0 +1,126 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepAlive(t *testing.T) {
+	s, err := Serve(0, named("hello"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	conn, err := net.Dial("tcp", s.Addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Test: Two pipelined requests answered on one connection
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\nGET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	// The next response may have been read along with this one
+	r := io.Reader(conn)
+	for range 2 {
+		res, err := response.ResponseFromReader(r)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(res.Body))
+		assert.Empty(t, res.Get("Connection"))
+		r = io.MultiReader(bytes.NewReader(res.Leftover()), r)
+	}
+
+	// Test: Connection: close ends the connection after the response
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	res, err := response.ResponseFromReader(r)
+	require.NoError(t, err)
+	assert.Equal(t, "close", res.Get("Connection"))
+	assert.Empty(t, res.Leftover())
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestShutdown(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("finished"))
+	})
+	require.NoError(t, err)
+
+	hookRan := make(chan struct{})
+	s.RegisterOnShutdown(func() { close(hookRan) })
+
+	idle, err := net.Dial("tcp", s.Addr)
+	require.NoError(t, err)
+	defer idle.Close()
+
+	busy, err := net.Dial("tcp", s.Addr)
+	require.NoError(t, err)
+	defer busy.Close()
+	_, err = busy.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	done := make(chan error)
+	go func() {
+		done <- s.Shutdown(context.Background())
+	}()
+	<-hookRan
+
+	// Test: Idle connection is closed, the busy one keeps going
+	idle.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = idle.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned with a request in flight")
+	default:
+	}
+
+	// Test: In flight request finishes, then its connection is closed
+	close(release)
+	busy.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := io.ReadAll(busy)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "finished")
+	require.NoError(t, <-done)
+
+	// Test: No new connections
+	_, err = net.Dial("tcp", s.Addr)
+	assert.Error(t, err)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	// Test: Connections still busy at the deadline are closed
+	started := make(chan struct{})
+	s, err := Serve(0, func(w *response.Writer, req *request.Request) {
+		close(started)
+		time.Sleep(time.Second)
+	})
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", s.Addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, err)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
@@ -0,0 +1,335 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCertReloadInterval is how often certificate files loaded by
+// ListenAndServeTLS are checked for changes
+const DefaultCertReloadInterval = 10 * time.Second
+
+var ErrNoCertificate = errors.New("No certificate for server name")
+
+// CertStore holds the server's certificates and picks one per connection
+// from the name the client asked for with SNI. Certificates loaded from
+// files are reloaded when the files change, so they can be renewed without
+// a restart. Use GetCertificate as tls.Config.GetCertificate.
+type CertStore struct {
+	// ReloadInterval is how often handshakes check the files for changes.
+	// Files are only reloaded through Reload when zero.
+	ReloadInterval time.Duration
+
+	// reloadMu is held while files are reloaded, mu while the certificates
+	// are read or replaced
+	reloadMu  sync.Mutex
+	mu        sync.RWMutex
+	certs     []*storedCert
+	byName    map[string]*tls.Certificate
+	lastCheck time.Time
+}
+
+type storedCert struct {
+	certFile string
+	keyFile  string
+	modTime  time.Time
+	cert     *tls.Certificate
+}
+
+func NewCertStore() *CertStore {
+	return &CertStore{
+		ReloadInterval: DefaultCertReloadInterval,
+		byName:         map[string]*tls.Certificate{},
+	}
+}
+
+// AddFiles loads a PEM certificate and key. The first certificate added is
+// used for clients that send no matching server name.
+func (cs *CertStore) AddFiles(certFile, keyFile string) error {
+	stored := &storedCert{certFile: certFile, keyFile: keyFile}
+	if err := stored.load(); err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.certs = append(cs.certs, stored)
+	cs.index()
+	return nil
+}
+
+// AddCertificate adds a certificate that is already in memory
+func (cs *CertStore) AddCertificate(cert tls.Certificate) error {
+	stored := &storedCert{cert: &cert}
+	if err := stored.parseLeaf(); err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.certs = append(cs.certs, stored)
+	cs.index()
+	return nil
+}
+
+// Reload reads again the certificate files that changed since they were
+// loaded. A pair that fails to load keeps serving the old certificate and
+// the error is returned.
+func (cs *CertStore) Reload() error {
+	cs.reloadMu.Lock()
+	defer cs.reloadMu.Unlock()
+
+	return cs.reload()
+}
+
+// reload does the work of Reload with reloadMu held. Files are read without
+// holding mu so handshakes carry on with the old certificates meanwhile.
+func (cs *CertStore) reload() error {
+	cs.mu.RLock()
+	certs := slices.Clone(cs.certs)
+	cs.mu.RUnlock()
+
+	// Only reloads change stored certificates, reloadMu keeps them still
+	var errs []error
+	reloaded := map[*storedCert]*storedCert{}
+	for _, stored := range certs {
+		if stored.certFile == "" {
+			continue
+		}
+
+		modTime, err := filesModTime(stored.certFile, stored.keyFile)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if !modTime.After(stored.modTime) {
+			continue
+		}
+
+		fresh := &storedCert{certFile: stored.certFile, keyFile: stored.keyFile}
+		if err := fresh.load(); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		reloaded[stored] = fresh
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.lastCheck = time.Now()
+	for stored, fresh := range reloaded {
+		*stored = *fresh
+	}
+	if len(reloaded) > 0 {
+		cs.index()
+	}
+
+	return errors.Join(errs...)
+}
+
+// GetCertificate picks the certificate for a handshake: an exact match on
+// the server name, then a wildcard match, then the first certificate added
+func (cs *CertStore) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cs.maybeReload()
+
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	if len(cs.certs) == 0 {
+		return nil, ErrNoCertificate
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := cs.byName[name]; ok {
+		return cert, nil
+	}
+
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		if cert, ok := cs.byName["*."+parent]; ok {
+			return cert, nil
+		}
+	}
+
+	return cs.certs[0].cert, nil
+}
+
+func (cs *CertStore) maybeReload() {
+	if cs.ReloadInterval <= 0 || !cs.reloadDue() {
+		return
+	}
+
+	// One handshake reloads, the others go on with the current certificates
+	if !cs.reloadMu.TryLock() {
+		return
+	}
+	defer cs.reloadMu.Unlock()
+
+	// Another handshake may have reloaded in the meantime
+	if cs.reloadDue() {
+		// Failures leave the old certificates in place
+		cs.reload()
+	}
+}
+
+func (cs *CertStore) reloadDue() bool {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	return time.Since(cs.lastCheck) >= cs.ReloadInterval
+}
+
+// index maps every name the certificates cover to the first certificate
+// covering it
+func (cs *CertStore) index() {
+	cs.byName = map[string]*tls.Certificate{}
+	for _, stored := range cs.certs {
+		for _, name := range certNames(stored.cert.Leaf) {
+			if _, ok := cs.byName[name]; !ok {
+				cs.byName[name] = stored.cert
+			}
+		}
+	}
+}
+
+func (stored *storedCert) load() error {
+	modTime, err := filesModTime(stored.certFile, stored.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(stored.certFile, stored.keyFile)
+	if err != nil {
+		return fmt.Errorf("Loading %s: %w", stored.certFile, err)
+	}
+
+	stored.cert = &cert
+	stored.modTime = modTime
+	return stored.parseLeaf()
+}
+
+func (stored *storedCert) parseLeaf() error {
+	if stored.cert.Leaf != nil {
+		return nil
+	}
+
+	if len(stored.cert.Certificate) == 0 {
+		return fmt.Errorf("Certificate is empty")
+	}
+
+	leaf, err := x509.ParseCertificate(stored.cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+	stored.cert.Leaf = leaf
+
+	return nil
+}
+
+func certNames(leaf *x509.Certificate) []string {
+	var names []string
+	for _, name := range leaf.DNSNames {
+		names = append(names, strings.ToLower(name))
+	}
+
+	// The common name only counts when there are no SANs
+	if len(names) == 0 && leaf.Subject.CommonName != "" {
+		names = append(names, strings.ToLower(leaf.Subject.CommonName))
+	}
+
+	return names
+}
+
+// filesModTime is the latest modification time of the files
+func filesModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// ServeTLS is Serve over TLS. Certificates come from certFile and keyFile,
+// which are reloaded when they change, and from TLSConfig. Both files may
+// be empty when TLSConfig provides the certificates.
+func (s *Server) ServeTLS(l net.Listener, certFile, keyFile string) error {
+	config, err := s.tlsConfig(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+
+	return s.Serve(tls.NewListener(l, config))
+}
+
+func (s *Server) tlsConfig(certFile, keyFile string) (*tls.Config, error) {
+	config := &tls.Config{}
+	if s.TLSConfig != nil {
+		config = s.TLSConfig.Clone()
+	}
+
+	if certFile != "" || keyFile != "" {
+		store := NewCertStore()
+		if err := store.AddFiles(certFile, keyFile); err != nil {
+			return nil, err
+		}
+
+		if config.GetCertificate != nil {
+			return nil, fmt.Errorf("TLSConfig.GetCertificate is set, certificate files cannot be used")
+		}
+		config.GetCertificate = store.GetCertificate
+	}
+
+	if s.ClientCAFile != "" {
+		pool, err := LoadCertPool(s.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.ClientCAs = pool
+		// Certificates are always verified. Whether one is needed is up to
+		// the routes unless TLSConfig already requires one.
+		switch config.ClientAuth {
+		case tls.NoClientCert, tls.RequestClientCert:
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		case tls.RequireAnyClientCert:
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	// CAs without a ClientAuth would never ask for a certificate
+	if config.ClientCAs != nil && config.ClientAuth == tls.NoClientCert {
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	if len(config.Certificates) == 0 && config.GetCertificate == nil && config.GetConfigForClient == nil {
+		return nil, fmt.Errorf("TLS needs a certificate, from files or TLSConfig")
+	}
+
+	// Only HTTP/1.1 is spoken, advertise it so ALPN clients agree on it
+	// and never offer HTTP/2
+	config.NextProtos = slices.DeleteFunc(slices.Clone(config.NextProtos), func(proto string) bool {
+		return proto == "h2" || proto == "h2c"
+	})
+	if len(config.NextProtos) == 0 {
+		config.NextProtos = []string{"http/1.1"}
+	}
+
+	return config, nil
+}
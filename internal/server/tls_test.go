@@ -0,0 +1,199 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, cert := writeCert(t, dir, "localhost", nil)
+
+	s := &Server{
+		Handler: func(w *response.Writer, req *request.Request) {
+			if req.TLS == nil {
+				w.Write([]byte("plain"))
+				return
+			}
+			w.Write([]byte(req.TLS.ServerName + " " + req.TLS.NegotiatedProtocol))
+		},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.ServeTLS(l, certFile, keyFile)
+	defer s.Close()
+
+	// Test: Request over TLS sees the connection state and ALPN result
+	res := tlsGet(t, l.Addr().String(), "/", &tls.Config{
+		ServerName: "localhost",
+		RootCAs:    certPool(cert),
+		NextProtos: []string{"h2", "http/1.1"},
+	})
+	assert.Equal(t, "localhost http/1.1", string(res.Body))
+
+	// Test: HTTP/2 is never offered
+	protos := []string{"h2", "http/1.1"}
+	config, err := (&Server{TLSConfig: &tls.Config{NextProtos: protos}}).tlsConfig(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"http/1.1"}, config.NextProtos)
+	assert.Equal(t, []string{"h2", "http/1.1"}, protos)
+
+	// Test: No certificate at all
+	assert.Error(t, (&Server{}).ServeTLS(l, "", ""))
+}
+
+func TestCertStore(t *testing.T) {
+	dir := t.TempDir()
+	aCert, aKey, a := writeCert(t, filepath.Join(dir, "a"), "a.test", nil)
+	bCert, bKey, b := writeCert(t, filepath.Join(dir, "b"), "*.b.test", nil)
+
+	store := NewCertStore()
+	store.ReloadInterval = 0
+	require.NoError(t, store.AddFiles(aCert, aKey))
+	require.NoError(t, store.AddFiles(bCert, bKey))
+
+	s := &Server{
+		Handler:   named("ok"),
+		TLSConfig: &tls.Config{GetCertificate: store.GetCertificate},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.ServeTLS(l, "", "")
+	defer s.Close()
+
+	pool := certPool(a, b)
+
+	// Test: Certificate picked by SNI, wildcards included
+	assert.Equal(t, "a.test", peerName(t, l.Addr().String(), "a.test", pool))
+	assert.Equal(t, "*.b.test", peerName(t, l.Addr().String(), "www.b.test", pool))
+
+	// Test: Unknown names get the first certificate
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{ServerName: "other.test", InsecureSkipVerify: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a.test"}, conn.ConnectionState().PeerCertificates[0].DNSNames)
+	conn.Close()
+
+	// Test: Renewed files are picked up without a restart
+	_, _, renewed := writeCert(t, filepath.Join(dir, "a"), "a.test", big.NewInt(2))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(aCert, later, later))
+	require.NoError(t, store.Reload())
+
+	conn, err = tls.Dial("tcp", l.Addr().String(), &tls.Config{ServerName: "a.test", RootCAs: certPool(renewed)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64())
+	conn.Close()
+
+	// Test: Handshakes racing a due reload
+	store.ReloadInterval = time.Nanosecond
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{ServerName: "a.test", RootCAs: certPool(renewed)})
+			if assert.NoError(t, err) {
+				conn.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	store.ReloadInterval = 0
+
+	// Test: A broken file keeps the old certificate
+	require.NoError(t, os.WriteFile(aCert, []byte("garbage"), 0o600))
+	later = later.Add(time.Minute)
+	require.NoError(t, os.Chtimes(aCert, later, later))
+	require.Error(t, store.Reload())
+	assert.Equal(t, "a.test", peerName(t, l.Addr().String(), "a.test", certPool(renewed, b)))
+}
+
+func tlsGet(t *testing.T, addr, target string, config *tls.Config) *response.Response {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, config)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("GET " + target + " HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n"))
+	require.NoError(t, err)
+	res, err := response.ResponseFromReader(conn)
+	require.NoError(t, err)
+	return res
+}
+
+func peerName(t *testing.T, addr, serverName string, pool *x509.CertPool) string {
+	t.Helper()
+
+	conn, err := tls.Dial("tcp", addr, &tls.Config{ServerName: serverName, RootCAs: pool})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	return conn.ConnectionState().PeerCertificates[0].DNSNames[0]
+}
+
+// writeCert writes a self-signed certificate for name and its key into
+// dir. A nil serial picks 1.
+func writeCert(t *testing.T, dir, name string, serial *big.Int) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+
+	if serial == nil {
+		serial = big.NewInt(1)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.MkdirAll(dir, 0o700))
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600))
+
+	return certFile, keyFile, cert
+}
+
+func certPool(certs ...*x509.Certificate) *x509.CertPool {
+	pool := x509.NewCertPool()
+	for _, cert := range certs {
+		pool.AddCert(cert)
+	}
+
+	return pool
+}
@@ -0,0 +1,422 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	continuationFrame = 0
+	TextMessage       = 1
+	BinaryMessage     = 2
+	CloseMessage      = 8
+	PingMessage       = 9
+	PongMessage       = 10
+)
+
+// Close status codes from RFC 6455 section 7.4.1
+const (
+	CloseNormalClosure      = 1000
+	CloseGoingAway          = 1001
+	CloseProtocolError      = 1002
+	CloseUnsupportedData    = 1003
+	CloseNoStatusReceived   = 1005
+	CloseAbnormalClosure    = 1006
+	CloseInvalidPayloadData = 1007
+	ClosePolicyViolation    = 1008
+	CloseMessageTooBig      = 1009
+	CloseInternalServerErr  = 1011
+)
+
+const DefaultMaxMessageSize = 1 << 20
+
+// Control frames carry at most this much payload
+const maxControlPayload = 125
+
+// How long Close waits for the peer to answer the close handshake
+const closeTimeout = 5 * time.Second
+
+var ErrCloseSent = errors.New("websocket: close frame already sent")
+
+// CloseError is returned by ReadMessage once the peer has closed the
+// connection, or after a protocol violation made this side close it.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Reason)
+}
+
+type Conn struct {
+	conn   net.Conn
+	br     *bufio.Reader
+	server bool
+
+	// MaxMessageSize limits the total payload of a message across all
+	// its fragments
+	MaxMessageSize int64
+
+	// FragmentSize splits outgoing data messages into frames of at most
+	// this many bytes when set
+	FragmentSize int
+
+	// OnPong is called with the payload of each pong received
+	OnPong func(data []byte)
+
+	writeMu   sync.Mutex
+	closeSent bool
+}
+
+// NewConn wraps a connection that has completed the opening handshake. br
+// must read from conn and may hold bytes that arrived with the handshake.
+// Servers expect masked frames from clients and send unmasked ones, clients
+// the reverse.
+func NewConn(conn net.Conn, br *bufio.Reader, server bool) *Conn {
+	if br == nil {
+		br = bufio.NewReader(conn)
+	}
+
+	return &Conn{
+		conn:           conn,
+		br:             br,
+		server:         server,
+		MaxMessageSize: DefaultMaxMessageSize,
+	}
+}
+
+type frame struct {
+	fin     bool
+	rsv     byte
+	opcode  int
+	payload []byte
+}
+
+// ReadMessage returns the next complete text or binary message. Pings are
+// answered and pongs handed to OnPong along the way. When the peer closes
+// the connection, or sends something that breaks the protocol, the close
+// handshake is answered and a *CloseError returned.
+func (c *Conn) ReadMessage() (messageType int, data []byte, err error) {
+	messageType = -1
+
+	for {
+		f, err := c.readFrame(int64(len(data)))
+		if err != nil {
+			return -1, nil, c.failRead(err)
+		}
+
+		switch f.opcode {
+		case PingMessage:
+			if err := c.writeFrame(true, PongMessage, f.payload); err != nil && !errors.Is(err, ErrCloseSent) {
+				return -1, nil, err
+			}
+			continue
+
+		case PongMessage:
+			if c.OnPong != nil {
+				c.OnPong(f.payload)
+			}
+			continue
+
+		case CloseMessage:
+			return -1, nil, c.handleClose(f.payload)
+
+		case continuationFrame:
+			if messageType == -1 {
+				return -1, nil, c.failRead(&CloseError{CloseProtocolError, "continuation without a started message"})
+			}
+
+		case TextMessage, BinaryMessage:
+			if messageType != -1 {
+				return -1, nil, c.failRead(&CloseError{CloseProtocolError, "new message before the last one finished"})
+			}
+			messageType = f.opcode
+
+		default:
+			return -1, nil, c.failRead(&CloseError{CloseProtocolError, "unknown opcode"})
+		}
+
+		data = append(data, f.payload...)
+		if !f.fin {
+			continue
+		}
+
+		if messageType == TextMessage && !utf8.Valid(data) {
+			return -1, nil, c.failRead(&CloseError{CloseInvalidPayloadData, "invalid utf-8 in text message"})
+		}
+
+		return messageType, data, nil
+	}
+}
+
+// readFrame reads one frame, unmasking the payload. buffered is the size of
+// the message read so far, used to enforce MaxMessageSize before the
+// payload is read.
+func (c *Conn) readFrame(buffered int64) (frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return frame{}, err
+	}
+
+	f := frame{
+		fin:    header[0]&0x80 != 0,
+		rsv:    header[0] & 0x70,
+		opcode: int(header[0] & 0x0f),
+	}
+	masked := header[1]&0x80 != 0
+	length := int64(header[1] & 0x7f)
+
+	// No extensions are negotiated so the reserved bits must be clear
+	if f.rsv != 0 {
+		return frame{}, &CloseError{CloseProtocolError, "reserved bits set"}
+	}
+
+	if masked != c.server {
+		if c.server {
+			return frame{}, &CloseError{CloseProtocolError, "client frames must be masked"}
+		}
+		return frame{}, &CloseError{CloseProtocolError, "server frames must not be masked"}
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return frame{}, err
+		}
+		if ext[0]&0x80 != 0 {
+			return frame{}, &CloseError{CloseProtocolError, "invalid payload length"}
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]))
+	}
+
+	if f.opcode >= CloseMessage {
+		if !f.fin {
+			return frame{}, &CloseError{CloseProtocolError, "fragmented control frame"}
+		}
+		if length > maxControlPayload {
+			return frame{}, &CloseError{CloseProtocolError, "control frame too large"}
+		}
+	} else if c.MaxMessageSize > 0 && buffered+length > c.MaxMessageSize {
+		return frame{}, &CloseError{CloseMessageTooBig, "message too big"}
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+			return frame{}, err
+		}
+	}
+
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, f.payload); err != nil {
+		return frame{}, err
+	}
+
+	if masked {
+		maskBytes(mask, f.payload)
+	}
+
+	return f, nil
+}
+
+func (c *Conn) handleClose(payload []byte) error {
+	closeErr := &CloseError{Code: CloseNoStatusReceived}
+
+	switch {
+	case len(payload) == 1:
+		return c.failRead(&CloseError{CloseProtocolError, "invalid close payload"})
+	case len(payload) >= 2:
+		closeErr.Code = int(binary.BigEndian.Uint16(payload))
+		closeErr.Reason = string(payload[2:])
+		if !validCloseCode(closeErr.Code) {
+			return c.failRead(&CloseError{CloseProtocolError, "invalid close code"})
+		}
+		if !utf8.ValidString(closeErr.Reason) {
+			return c.failRead(&CloseError{CloseInvalidPayloadData, "invalid utf-8 in close reason"})
+		}
+	}
+
+	// Echo the status code back to complete the handshake
+	reply := []byte{}
+	if closeErr.Code != CloseNoStatusReceived {
+		reply = closePayload(closeErr.Code, "")
+	}
+	if err := c.writeFrame(true, CloseMessage, reply); err != nil && !errors.Is(err, ErrCloseSent) {
+		return err
+	}
+
+	return closeErr
+}
+
+// failRead sends a close frame for protocol errors found while reading
+func (c *Conn) failRead(err error) error {
+	var closeErr *CloseError
+	if errors.As(err, &closeErr) {
+		c.writeFrame(true, CloseMessage, closePayload(closeErr.Code, closeErr.Reason))
+		return closeErr
+	}
+
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &CloseError{CloseAbnormalClosure, "connection closed without a close frame"}
+	}
+
+	return err
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003:
+		return true
+	case code >= 1007 && code <= 1011:
+		return true
+	case code >= 3000 && code <= 4999:
+		return true
+	}
+
+	return false
+}
+
+func closePayload(code int, reason string) []byte {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	return append(payload, reason...)
+}
+
+// WriteMessage sends a text or binary message, split into FragmentSize
+// frames when set
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", messageType)
+	}
+
+	if messageType == TextMessage && !utf8.Valid(data) {
+		return fmt.Errorf("websocket: text message is not valid utf-8")
+	}
+
+	if c.FragmentSize <= 0 || len(data) <= c.FragmentSize {
+		return c.writeFrame(true, messageType, data)
+	}
+
+	opcode := messageType
+	for len(data) > 0 {
+		n := min(len(data), c.FragmentSize)
+		if err := c.writeFrame(n == len(data), opcode, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+		opcode = continuationFrame
+	}
+
+	return nil
+}
+
+func (c *Conn) Ping(data []byte) error {
+	if len(data) > maxControlPayload {
+		return fmt.Errorf("websocket: ping payload too large")
+	}
+
+	return c.writeFrame(true, PingMessage, data)
+}
+
+// Close starts the close handshake, waits briefly for the peer's close
+// frame and closes the connection.
+func (c *Conn) Close(code int, reason string) error {
+	if len(reason) > maxControlPayload-2 {
+		// Cut on a rune boundary, the reason must stay valid UTF-8
+		end := maxControlPayload - 2
+		for end > 0 && !utf8.RuneStart(reason[end]) {
+			end--
+		}
+		reason = reason[:end]
+	}
+
+	err := c.writeFrame(true, CloseMessage, closePayload(code, reason))
+	if err == nil {
+		c.conn.SetReadDeadline(time.Now().Add(closeTimeout))
+		for {
+			f, err := c.readFrame(0)
+			if err != nil || f.opcode == CloseMessage {
+				break
+			}
+		}
+	}
+
+	return c.conn.Close()
+}
+
+func (c *Conn) writeFrame(fin bool, opcode int, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if opcode == CloseMessage {
+		c.closeSent = true
+	}
+
+	header := make([]byte, 0, 14)
+	first := byte(opcode)
+	if fin {
+		first |= 0x80
+	}
+	header = append(header, first)
+
+	maskBit := byte(0)
+	if !c.server {
+		maskBit = 0x80
+	}
+
+	length := len(payload)
+	switch {
+	case length <= 125:
+		header = append(header, maskBit|byte(length))
+	case length <= 0xffff:
+		header = append(header, maskBit|126)
+		header = binary.BigEndian.AppendUint16(header, uint16(length))
+	default:
+		header = append(header, maskBit|127)
+		header = binary.BigEndian.AppendUint64(header, uint64(length))
+	}
+
+	if !c.server {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		header = append(header, mask[:]...)
+
+		masked := make([]byte, length)
+		copy(masked, payload)
+		maskBytes(mask, masked)
+		payload = masked
+	}
+
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func maskBytes(mask [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i%4]
+	}
+}
@@ -0,0 +1,137 @@
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+)
+
+// Appended to the client's key to build Sec-WebSocket-Accept (RFC 6455
+// section 1.3)
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+type Upgrader struct {
+	// Subprotocols the server supports in order of preference
+	Subprotocols []string
+
+	// CheckOrigin rejects cross origin requests when it returns false. All
+	// origins are allowed when nil.
+	CheckOrigin func(req *request.Request) bool
+
+	// MaxMessageSize limits incoming messages, DefaultMaxMessageSize if 0
+	MaxMessageSize int64
+}
+
+type HandshakeError struct {
+	StatusCode response.StatusCode
+	Message    string
+}
+
+func (e *HandshakeError) Error() string {
+	return fmt.Sprintf("websocket handshake: %s", e.Message)
+}
+
+// CheckHandshake validates an opening handshake request and returns the
+// client's Sec-WebSocket-Key.
+func CheckHandshake(req *request.Request) (string, error) {
+	if req.RequestLine.Method != "GET" {
+		return "", &HandshakeError{response.StatusClientError, "method must be GET"}
+	}
+
+	if !headerHasToken(req.Get("Upgrade"), "websocket") {
+		return "", &HandshakeError{response.StatusUpgradeRequired, "missing Upgrade: websocket"}
+	}
+
+	if !headerHasToken(req.Get("Connection"), "upgrade") {
+		return "", &HandshakeError{response.StatusClientError, "missing Connection: Upgrade"}
+	}
+
+	if strings.TrimSpace(req.Get("Sec-WebSocket-Version")) != "13" {
+		return "", &HandshakeError{response.StatusUpgradeRequired, "unsupported Sec-WebSocket-Version"}
+	}
+
+	key := strings.TrimSpace(req.Get("Sec-WebSocket-Key"))
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil || len(decoded) != 16 {
+		return "", &HandshakeError{response.StatusClientError, "invalid Sec-WebSocket-Key"}
+	}
+
+	return key, nil
+}
+
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Upgrade completes the handshake on w and hijacks the connection, returning
+// it speaking the WebSocket protocol. The server no longer manages the
+// connection once this succeeds, the caller must Close it. On a failed
+// handshake an error response is written and a *HandshakeError returned.
+func (u *Upgrader) Upgrade(w *response.Writer, req *request.Request) (*Conn, error) {
+	key, err := CheckHandshake(req)
+	if err == nil && u.CheckOrigin != nil && !u.CheckOrigin(req) {
+		err = &HandshakeError{response.StatusForbidden, "origin not allowed"}
+	}
+	if err != nil {
+		handshakeErr := err.(*HandshakeError)
+		if handshakeErr.StatusCode == response.StatusUpgradeRequired {
+			w.Header().Set("sec-websocket-version", "13")
+		}
+		w.SetStatus(handshakeErr.StatusCode)
+		w.Write([]byte(handshakeErr.Message))
+		return nil, err
+	}
+
+	h := headers.NewHeaders()
+	h.Set("upgrade", "websocket")
+	h.Set("connection", "Upgrade")
+	h.Set("sec-websocket-accept", AcceptKey(key))
+	if protocol := u.selectSubprotocol(req); protocol != "" {
+		h.Set("sec-websocket-protocol", protocol)
+	}
+
+	if err := w.WriteStatusLine(response.StatusSwitchingProtocols); err != nil {
+		return nil, err
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return nil, err
+	}
+	conn, rw, err := w.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewConn(conn, rw.Reader, true)
+	if u.MaxMessageSize > 0 {
+		c.MaxMessageSize = u.MaxMessageSize
+	}
+
+	return c, nil
+}
+
+func (u *Upgrader) selectSubprotocol(req *request.Request) string {
+	requested := req.Get("Sec-WebSocket-Protocol")
+	for _, protocol := range u.Subprotocols {
+		if headerHasToken(requested, protocol) {
+			return protocol
+		}
+	}
+
+	return ""
+}
+
+func headerHasToken(value, token string) bool {
+	for _, part := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(part), token) {
+			return true
+		}
+	}
+
+	return false
+}
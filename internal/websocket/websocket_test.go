@@ -0,0 +1,294 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/TJ-R/httpfromtcp/internal/headers"
+	"github.com/TJ-R/httpfromtcp/internal/request"
+	"github.com/TJ-R/httpfromtcp/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandshake(t *testing.T) {
+	// Test: Accept key from RFC 6455 section 1.3
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", AcceptKey("dGhlIHNhbXBsZSBub25jZQ=="))
+
+	// Test: Valid handshake
+	req := handshakeRequest()
+	key, err := CheckHandshake(req)
+	require.NoError(t, err)
+	assert.Equal(t, "dGhlIHNhbXBsZSBub25jZQ==", key)
+
+	// Test: Missing upgrade
+	req = handshakeRequest()
+	req.Headers.Delete("upgrade")
+	_, err = CheckHandshake(req)
+	require.Error(t, err)
+
+	// Test: Wrong version
+	req = handshakeRequest()
+	req.Headers.Set("sec-websocket-version", "8")
+	_, err = CheckHandshake(req)
+	require.Error(t, err)
+
+	// Test: Key that is not 16 bytes
+	req = handshakeRequest()
+	req.Headers.Set("sec-websocket-key", "c2hvcnQ=")
+	_, err = CheckHandshake(req)
+	require.Error(t, err)
+
+	// Test: Upgrade writes 101 with the accept key and subprotocol
+	buf := &bytes.Buffer{}
+	w := &response.Writer{W: buf}
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	w.EnableHijack(func() (net.Conn, *bufio.ReadWriter, error) {
+		return server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)), nil
+	})
+	req = handshakeRequest()
+	req.Headers.Set("sec-websocket-protocol", "chat, superchat")
+	u := &Upgrader{Subprotocols: []string{"superchat"}}
+	c, err := u.Upgrade(w, req)
+	require.NoError(t, err)
+	require.NotNil(t, c)
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 101 Switching Protocols\r\n"))
+	assert.Contains(t, buf.String(), "sec-websocket-accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n")
+	assert.Contains(t, buf.String(), "sec-websocket-protocol: superchat\r\n")
+	assert.Contains(t, buf.String(), "upgrade: websocket\r\n")
+	assert.True(t, w.Hijacked())
+
+	// Test: Rejected origin
+	buf = &bytes.Buffer{}
+	w = &response.Writer{W: buf}
+	u = &Upgrader{CheckOrigin: func(req *request.Request) bool { return false }}
+	_, err = u.Upgrade(w, handshakeRequest())
+	require.Error(t, err)
+	require.NoError(t, w.Close())
+	assert.True(t, strings.HasPrefix(buf.String(), "HTTP/1.1 403 Forbidden\r\n"))
+}
+
+// Cases modelled on the Autobahn testsuite sections, run against an echo
+// server over an in-memory connection
+func TestFraming(t *testing.T) {
+	long := strings.Repeat("x", 70000)
+
+	cases := []struct {
+		name      string
+		send      [][]byte
+		expect    []frame
+		closeCode int
+	}{
+		{
+			name:   "1.1 text echo",
+			send:   [][]byte{rawFrame(true, 0, TextMessage, true, []byte("hello"))},
+			expect: []frame{{fin: true, opcode: TextMessage, payload: []byte("hello")}},
+		},
+		{
+			name:   "1.2 binary echo with 16 bit length",
+			send:   [][]byte{rawFrame(true, 0, BinaryMessage, true, bytes.Repeat([]byte{0xfe}, 300))},
+			expect: []frame{{fin: true, opcode: BinaryMessage, payload: bytes.Repeat([]byte{0xfe}, 300)}},
+		},
+		{
+			name:   "1.2 binary echo with 64 bit length",
+			send:   [][]byte{rawFrame(true, 0, BinaryMessage, true, []byte(long))},
+			expect: []frame{{fin: true, opcode: BinaryMessage, payload: []byte(long)}},
+		},
+		{
+			name:   "2.2 ping answered with pong",
+			send:   [][]byte{rawFrame(true, 0, PingMessage, true, []byte("ping"))},
+			expect: []frame{{fin: true, opcode: PongMessage, payload: []byte("ping")}},
+		},
+		{
+			name:      "2.5 ping payload too large",
+			send:      [][]byte{rawFrame(true, 0, PingMessage, true, bytes.Repeat([]byte("a"), 126))},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "3.1 reserved bits set",
+			send:      [][]byte{rawFrame(true, 0x40, TextMessage, true, []byte("rsv"))},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "4.1 reserved opcode",
+			send:      [][]byte{rawFrame(true, 0, 3, true, nil)},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name: "5.6 fragmented text with ping in between",
+			send: [][]byte{
+				rawFrame(false, 0, TextMessage, true, []byte("frag")),
+				rawFrame(true, 0, PingMessage, true, []byte("mid")),
+				rawFrame(true, 0, continuationFrame, true, []byte("ment")),
+			},
+			expect: []frame{
+				{fin: true, opcode: PongMessage, payload: []byte("mid")},
+				{fin: true, opcode: TextMessage, payload: []byte("fragment")},
+			},
+		},
+		{
+			name:      "5.9 continuation without a message",
+			send:      [][]byte{rawFrame(true, 0, continuationFrame, true, []byte("orphan"))},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "5.3 fragmented control frame",
+			send:      [][]byte{rawFrame(false, 0, PingMessage, true, []byte("ping"))},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "6.3 invalid utf-8 text",
+			send:      [][]byte{rawFrame(true, 0, TextMessage, true, []byte{0xce, 0xba, 0xe1, 0xbd})},
+			closeCode: CloseInvalidPayloadData,
+		},
+		{
+			name:      "7.1 normal close echoed",
+			send:      [][]byte{rawFrame(true, 0, CloseMessage, true, closePayload(CloseNormalClosure, "bye"))},
+			closeCode: CloseNormalClosure,
+		},
+		{
+			name:      "7.9 invalid close code",
+			send:      [][]byte{rawFrame(true, 0, CloseMessage, true, closePayload(1005, ""))},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "7.3 one byte close payload",
+			send:      [][]byte{rawFrame(true, 0, CloseMessage, true, []byte{0x03})},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "unmasked client frame",
+			send:      [][]byte{rawFrame(true, 0, TextMessage, false, []byte("plain"))},
+			closeCode: CloseProtocolError,
+		},
+		{
+			name:      "9.1 message too big",
+			send:      [][]byte{rawFrame(true, 0, BinaryMessage, true, make([]byte, 2048))},
+			closeCode: CloseMessageTooBig,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			serverConn, clientConn := net.Pipe()
+			defer clientConn.Close()
+
+			server := NewConn(serverConn, nil, true)
+			server.MaxMessageSize = 1024 * 100
+			if tc.closeCode == CloseMessageTooBig {
+				server.MaxMessageSize = 1024
+			}
+			go echo(server)
+
+			client := NewConn(clientConn, nil, false)
+			client.MaxMessageSize = 0
+			// net.Pipe is unbuffered so replies are read while sending
+			go func() {
+				for _, raw := range tc.send {
+					if _, err := clientConn.Write(raw); err != nil {
+						return
+					}
+				}
+			}()
+
+			for _, want := range tc.expect {
+				got, err := client.readFrame(0)
+				require.NoError(t, err)
+				assert.Equal(t, want.opcode, got.opcode)
+				assert.Equal(t, want.payload, got.payload)
+			}
+
+			if tc.closeCode != 0 {
+				got, err := client.readFrame(0)
+				require.NoError(t, err)
+				require.Equal(t, CloseMessage, got.opcode)
+				require.GreaterOrEqual(t, len(got.payload), 2)
+				assert.Equal(t, tc.closeCode, int(binary.BigEndian.Uint16(got.payload)))
+			}
+		})
+	}
+}
+
+func TestFragmentedWrite(t *testing.T) {
+	// Test: Outgoing messages split into FragmentSize frames
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	server := NewConn(serverConn, nil, true)
+	server.FragmentSize = 4
+	go server.WriteMessage(TextMessage, []byte("abcdefghij"))
+
+	client := NewConn(clientConn, nil, false)
+	messageType, data, err := client.ReadMessage()
+	require.NoError(t, err)
+	assert.Equal(t, TextMessage, messageType)
+	assert.Equal(t, "abcdefghij", string(data))
+}
+
+func TestCloseReason(t *testing.T) {
+	// Test: Long reasons are cut on a rune boundary
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	server := NewConn(serverConn, nil, true)
+	go server.Close(CloseNormalClosure, strings.Repeat("é", 100))
+
+	client := NewConn(clientConn, nil, false)
+	got, err := client.readFrame(0)
+	require.NoError(t, err)
+	require.Equal(t, CloseMessage, got.opcode)
+	assert.LessOrEqual(t, len(got.payload), maxControlPayload)
+	assert.True(t, utf8.Valid(got.payload[2:]))
+	assert.Equal(t, strings.Repeat("é", 61), string(got.payload[2:]))
+}
+
+func echo(c *Conn) {
+	for {
+		messageType, data, err := c.ReadMessage()
+		if err != nil {
+			c.conn.Close()
+			return
+		}
+		if err := c.WriteMessage(messageType, data); err != nil {
+			return
+		}
+	}
+}
+
+func rawFrame(fin bool, rsv byte, opcode int, masked bool, payload []byte) []byte {
+	c := &Conn{conn: &captureConn{}, server: !masked}
+	c.writeFrame(fin, opcode, payload)
+	raw := c.conn.(*captureConn).buf.Bytes()
+	raw[0] |= rsv
+	return raw
+}
+
+type captureConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *captureConn) Write(p []byte) (int, error) {
+	return c.buf.Write(p)
+}
+
+func handshakeRequest() *request.Request {
+	req := &request.Request{
+		RequestLine: request.RequestLine{Method: "GET", RequestTarget: "/chat", HttpVersion: "1.1"},
+		Headers:     headers.NewHeaders(),
+	}
+	req.Headers.Set("host", "localhost:42069")
+	req.Headers.Set("upgrade", "websocket")
+	req.Headers.Set("connection", "keep-alive, Upgrade")
+	req.Headers.Set("sec-websocket-key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Headers.Set("sec-websocket-version", "13")
+	return req
+}